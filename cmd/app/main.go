@@ -1,23 +1,117 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
 	"github.com/zahidhasanpapon/iam-bridge/internal/server"
 )
 
+const usage = `Usage: %s [--config path] [command]
+
+Commands:
+  serve         Start the server (default)
+  validate      Validate the configuration without starting the server
+  print-config  Print the resolved configuration with secrets masked
+
+Flags:
+`
+
 func main() {
+	configPath := flag.String("config", config.DefaultPath, "config file, or a directory holding config.yaml")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Flags may also follow the command
+	command := flag.Arg(0)
+	if flag.NArg() > 0 {
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	if flag.NArg() > 0 {
+		log.Printf("Unexpected arguments: %s\n", strings.Join(flag.Args(), " "))
+		os.Exit(2)
+	}
+
+	switch command {
+	case "", "serve":
+		os.Exit(serve(*configPath))
+	case "validate":
+		os.Exit(validate(*configPath))
+	case "print-config":
+		os.Exit(printConfig(*configPath))
+	default:
+		log.Printf("Unknown command: %s\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// serve runs the server until it shuts down and returns the exit code
+func serve(configPath string) int {
 	// Initialize the server
-	srv, err := server.NewServer()
+	srv, err := server.NewServer(configPath)
 	if err != nil {
 		log.Printf("Error initializing server: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 
 	// Start the server
 	if err := srv.Start(); err != nil {
 		log.Printf("Error starting server: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	return 0
+}
+
+// validate loads and validates the configuration without starting the
+// server, printing every problem found, and returns the exit code
+func validate(configPath string) int {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+
+	if err := cfg.Validate(); err != nil {
+		var validationErr *config.ValidationError
+		if !errors.As(err, &validationErr) {
+			fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+			return 1
+		}
+
+		fmt.Fprintf(os.Stderr, "Invalid config, %d problem(s) found:\n", len(validationErr.Problems))
+		for _, problem := range validationErr.Problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", problem)
+		}
+		return 1
+	}
+
+	fmt.Printf("Config is valid (%s)\n", strings.Join(cfg.Sources(), ", "))
+	return 0
+}
+
+// printConfig prints the configuration in effect after merging the config
+// files and applying environment variables, with secrets masked, and returns
+// the exit code
+func printConfig(configPath string) int {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("# Resolved from %s\n", strings.Join(cfg.Sources(), ", "))
+	if err := cfg.WriteYAML(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error printing config: %v\n", err)
+		return 1
 	}
+	return 0
 }
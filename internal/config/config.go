@@ -3,19 +3,37 @@ package config
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 )
 
+// DefaultPath is the directory config.yaml is read from by default
+const DefaultPath = "config"
+
 // Config holds all configuration for our program
 type Config struct {
 	App      AppConfig      `mapstructure:"app"`
 	IAM      IAMConfig      `mapstructure:"iam"`
 	Security SecurityConfig `mapstructure:"security"`
 	Logging  LogConfig      `mapstructure:"logging"`
+	Tenancy  TenancyConfig  `mapstructure:"tenancy"`
+
+	// problems are found while loading, such as unknown keys or unreadable
+	// secret files, and reported by Validate
+	problems []FieldError
+	// sources are the config files read, the base file first
+	sources []string
+	// watched are the base file and the overlay of its environment, even
+	// when the overlay does not exist yet
+	watched []string
 }
 
 // AppConfig holds all application configuration
@@ -24,14 +42,221 @@ type AppConfig struct {
 	Environment string `mapstructure:"environment"`
 	Port        int    `mapstructure:"port"`
 	Debug       bool   `mapstructure:"debug"`
+	// TrustedProxies are the IPs and CIDRs of the proxies whose
+	// X-Forwarded-For and X-Real-IP headers are trusted for the client IP.
+	// Empty trusts none, so the client IP is the peer address.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // KeycloakConfig holds Keycloak-specific configuration
 type KeycloakConfig struct {
+	BaseURL         string                `mapstructure:"base_url"`
+	Realm           string                `mapstructure:"realm"`
+	ClientID        string                `mapstructure:"client_id"`
+	ClientSecret    Secret                `mapstructure:"client_secret"`
+	TokenValidation TokenValidationConfig `mapstructure:"token_validation"`
+	// Tenants maps tenant IDs to their own realm and client. The realm and
+	// client above serve requests without a tenant and may be left empty.
+	Tenants map[string]KeycloakTenantConfig `mapstructure:"tenants"`
+}
+
+// KeycloakTenantConfig holds the realm and client credentials of a tenant
+type KeycloakTenantConfig struct {
+	// BaseURL overrides the shared Keycloak base URL for the tenant
 	BaseURL      string `mapstructure:"base_url"`
 	Realm        string `mapstructure:"realm"`
 	ClientID     string `mapstructure:"client_id"`
-	ClientSecret string `mapstructure:"client_secret"`
+	ClientSecret Secret `mapstructure:"client_secret"`
+}
+
+// OIDCConfig holds configuration for a generic OpenID Connect provider
+// discovered from its issuer
+type OIDCConfig struct {
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret Secret `mapstructure:"client_secret"`
+	// TokenEndpointAuthMethod is "client_secret_basic" (default) or "client_secret_post"
+	TokenEndpointAuthMethod string                `mapstructure:"token_endpoint_auth_method"`
+	Scopes                  []string              `mapstructure:"scopes"`
+	TokenValidation         TokenValidationConfig `mapstructure:"token_validation"`
+}
+
+// OktaConfig holds Okta-specific configuration
+type OktaConfig struct {
+	OrgURL string `mapstructure:"org_url"`
+	// AuthorizationServerID selects a custom authorization server such as
+	// "default"; when empty the org authorization server is used
+	AuthorizationServerID string                `mapstructure:"authorization_server_id"`
+	ClientID              string                `mapstructure:"client_id"`
+	ClientSecret          Secret                `mapstructure:"client_secret"`
+	Scopes                []string              `mapstructure:"scopes"`
+	Management            OktaManagementConfig  `mapstructure:"management"`
+	TokenValidation       TokenValidationConfig `mapstructure:"token_validation"`
+}
+
+// Auth0Config holds Auth0-specific configuration
+type Auth0Config struct {
+	// Domain is the tenant domain, such as "my-tenant.eu.auth0.com"
+	Domain       string `mapstructure:"domain"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret Secret `mapstructure:"client_secret"`
+	// Connection is the database connection used as the password-realm realm
+	Connection string `mapstructure:"connection"`
+	// Audience is the API identifier access tokens are issued for
+	Audience        string                `mapstructure:"audience"`
+	Scopes          []string              `mapstructure:"scopes"`
+	Management      Auth0ManagementConfig `mapstructure:"management"`
+	TokenValidation TokenValidationConfig `mapstructure:"token_validation"`
+}
+
+// Auth0ManagementConfig holds the machine-to-machine application used for the
+// Management API. When empty, the main client credentials are used.
+type Auth0ManagementConfig struct {
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret Secret `mapstructure:"client_secret"`
+}
+
+// CognitoConfig holds AWS Cognito user pool configuration
+type CognitoConfig struct {
+	Region       string `mapstructure:"region"`
+	UserPoolID   string `mapstructure:"user_pool_id"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret Secret `mapstructure:"client_secret"`
+	// Endpoint overrides the Cognito API endpoint, for example to point at a
+	// local emulator; JWKS and issuer URLs are derived from it as well
+	Endpoint string `mapstructure:"endpoint"`
+	// AccessKeyID and SecretAccessKey are optional static credentials for the
+	// admin APIs; the default AWS credential chain is used when empty
+	AccessKeyID     string                `mapstructure:"access_key_id"`
+	SecretAccessKey Secret                `mapstructure:"secret_access_key"`
+	TokenValidation TokenValidationConfig `mapstructure:"token_validation"`
+}
+
+// LDAPConfig holds LDAP / Active Directory configuration
+type LDAPConfig struct {
+	// URL is an ldap:// or ldaps:// URL of the directory server
+	URL                string `mapstructure:"url"`
+	StartTLS           bool   `mapstructure:"start_tls"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	// BindDN and BindPassword identify the service account used for searches
+	// and group modifications
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword Secret `mapstructure:"bind_password"`
+	UserBaseDN   string `mapstructure:"user_base_dn"`
+	UserFilter   string `mapstructure:"user_filter"`
+	// GroupBaseDN enables group search for roles and is required to assign or
+	// remove roles; without it roles come from the user's memberOf attribute
+	GroupBaseDN string               `mapstructure:"group_base_dn"`
+	GroupFilter string               `mapstructure:"group_filter"`
+	Attributes  LDAPAttributesConfig `mapstructure:"attributes"`
+	Pool        LDAPPoolConfig       `mapstructure:"pool"`
+	Session     SessionTokenConfig   `mapstructure:"session"`
+}
+
+// LDAPAttributesConfig maps directory attributes onto bridge user fields
+type LDAPAttributesConfig struct {
+	ID          string `mapstructure:"id"`
+	Username    string `mapstructure:"username"`
+	Email       string `mapstructure:"email"`
+	MemberOf    string `mapstructure:"member_of"`
+	GroupName   string `mapstructure:"group_name"`
+	GroupMember string `mapstructure:"group_member"`
+}
+
+// LDAPPoolConfig holds connection pool settings
+type LDAPPoolConfig struct {
+	Size        int           `mapstructure:"size"`
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+}
+
+// StaticConfig holds configuration for the static provider, which keeps users
+// in memory and needs no external IdP
+type StaticConfig struct {
+	// File is an optional YAML or JSON users file, loaded at startup
+	File string `mapstructure:"file"`
+	// Persist writes user and role changes back to File
+	Persist bool `mapstructure:"persist"`
+	// Roles is the catalog of assignable roles, in addition to those in File
+	Roles   []string           `mapstructure:"roles"`
+	Users   []StaticUser       `mapstructure:"users"`
+	Session SessionTokenConfig `mapstructure:"session"`
+}
+
+// StaticUser holds a user configured inline for the static provider
+type StaticUser struct {
+	// ID defaults to a UUID derived from the username, so it is stable
+	// across restarts
+	ID           string   `mapstructure:"id"`
+	Username     string   `mapstructure:"username"`
+	Email        string   `mapstructure:"email"`
+	PasswordHash string   `mapstructure:"password_hash"`
+	Roles        []string `mapstructure:"roles"`
+}
+
+// CompositeConfig holds configuration for the composite provider, which
+// chains several of the other configured providers
+type CompositeConfig struct {
+	// Strategy is "first-success", "primary-with-fallback" or
+	// "route-by-username-domain"
+	Strategy string             `mapstructure:"strategy"`
+	Backends []CompositeBackend `mapstructure:"backends"`
+	// HealthCheckInterval is how often primary-with-fallback checks backend health
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+}
+
+// CompositeBackend holds a backend of the composite provider
+type CompositeBackend struct {
+	// Provider names the provider block the backend is built from, e.g. "ldap"
+	Provider string `mapstructure:"provider"`
+	// Domains are the username domains routed to the backend by
+	// route-by-username-domain. A backend without domains takes all others.
+	Domains []string `mapstructure:"domains"`
+	// StripDomain removes "@domain" from usernames before they are sent on
+	StripDomain bool `mapstructure:"strip_domain"`
+}
+
+// SessionTokenConfig holds settings for tokens issued by the bridge itself,
+// for providers that have no tokens of their own
+type SessionTokenConfig struct {
+	// SigningKey is the HMAC secret used to sign session tokens (HS256)
+	SigningKey      Secret        `mapstructure:"signing_key"`
+	Issuer          string        `mapstructure:"issuer"`
+	AccessTokenTTL  time.Duration `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `mapstructure:"refresh_token_ttl"`
+}
+
+// OktaManagementConfig holds credentials for the Okta Management API. Either an
+// SSWS API token or a service app client ID with a private key is required.
+type OktaManagementConfig struct {
+	APIToken   Secret   `mapstructure:"api_token"`
+	ClientID   string   `mapstructure:"client_id"`
+	PrivateKey Secret   `mapstructure:"private_key"`
+	KeyID      string   `mapstructure:"key_id"`
+	Scopes     []string `mapstructure:"scopes"`
+}
+
+// TokenValidationConfig holds access token validation configuration
+type TokenValidationConfig struct {
+	// Mode is "remote" to ask the provider about every token (introspection
+	// or userinfo), or "local" to verify signatures against the provider's JWKS
+	Mode                   string        `mapstructure:"mode"`
+	Issuer                 string        `mapstructure:"issuer"`
+	Audience               []string      `mapstructure:"audience"`
+	ClockSkew              time.Duration `mapstructure:"clock_skew"`
+	JWKSCacheTTL           time.Duration `mapstructure:"jwks_cache_ttl"`
+	JWKSMinRefreshInterval time.Duration `mapstructure:"jwks_min_refresh_interval"`
+}
+
+// TenancyConfig holds how the tenant of a request is resolved
+type TenancyConfig struct {
+	// Mode is "header", "subdomain" or "path" (/api/v1/t/{tenant}/...).
+	// Tenancy is disabled when empty.
+	Mode string `mapstructure:"mode"`
+	// Header is the header carrying the tenant ID in header mode
+	Header string `mapstructure:"header"`
+	// BaseDomain is the domain tenant subdomains live under in subdomain
+	// mode, e.g. "bridge.example.com" for "acme.bridge.example.com"
+	BaseDomain string `mapstructure:"base_domain"`
 }
 
 // CORSConfig holds CORS-related configuration
@@ -41,31 +266,190 @@ type CORSConfig struct {
 	AllowedHeaders []string `mapstructure:"allowed_headers"`
 }
 
-// RateLimitConfig holds rate limiting configuration
+// RateLimitConfig holds rate limiting configuration. Each client gets a token
+// bucket refilled at RequestsPerSecond that holds up to Burst requests.
 type RateLimitConfig struct {
-	Enabled           bool `mapstructure:"enabled"`
-	RequestsPerSecond int  `mapstructure:"requests_per_second"`
+	Enabled           bool    `mapstructure:"enabled"`
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	// Burst defaults to RequestsPerSecond, rounded up
+	Burst int `mapstructure:"burst"`
+	// Key identifies clients: "ip" (default), "subject" for the authenticated
+	// user or "client" for the OAuth client the token was issued to. Requests
+	// without a token are keyed by IP.
+	Key    string               `mapstructure:"key"`
+	Routes []RateLimitRoute     `mapstructure:"routes"`
+	Store  RateLimitStoreConfig `mapstructure:"store"`
+	// PreAuth limits requests to authenticated routes per IP before their
+	// token is checked, so that requests with invalid tokens are limited too
+	PreAuth RateLimitPreAuthConfig `mapstructure:"pre_auth"`
+}
+
+// RateLimitPreAuthConfig holds the per-IP limit checked before authentication.
+// A zero rate defaults to the rate and burst above.
+type RateLimitPreAuthConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+// RateLimitStoreConfig holds where token buckets are kept
+type RateLimitStoreConfig struct {
+	// Type is "memory" (default), which limits every instance on its own, or
+	// "redis" to share limits between instances
+	Type string `mapstructure:"type"`
+	// FailureMode is "open" (default) to let requests through while the
+	// store is unreachable, or "closed" to reject them
+	FailureMode string      `mapstructure:"failure_mode"`
+	Redis       RedisConfig `mapstructure:"redis"`
+}
+
+// RedisConfig holds the connection to a Redis-compatible server
+type RedisConfig struct {
+	// Address is the host:port of the server
+	Address  string `mapstructure:"address"`
+	Username string `mapstructure:"username"`
+	Password Secret `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	TLS      bool   `mapstructure:"tls"`
+	// KeyPrefix namespaces the keys written, e.g. per deployment
+	KeyPrefix string `mapstructure:"key_prefix"`
+	// Timeout bounds every call, so an unreachable server does not stall requests
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// RateLimitRoute overrides the rate limit of a route or route group. Every
+// override has buckets of its own.
+type RateLimitRoute struct {
+	// Path is a route such as /api/v1/auth/login, or a group such as
+	// /api/v1/users covering the routes below it. The most specific wins.
+	Path string `mapstructure:"path"`
+	// Method restricts the override to one HTTP method
+	Method            string  `mapstructure:"method"`
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int     `mapstructure:"burst"`
+	// Key defaults to the key above
+	Key string `mapstructure:"key"`
+}
+
+// LoginProtectionConfig holds how failed logins are throttled. Failures are
+// counted per username and per IP. Past DelayAfter failures every attempt is
+// delayed, doubling from Delay up to MaxDelay, and at LockAfter failures
+// logins are refused for LockoutDuration, doubling with every further lockout
+// up to MaxLockoutDuration.
+type LoginProtectionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Window is how long failures are remembered after the last one
+	Window             time.Duration   `mapstructure:"window"`
+	Delay              time.Duration   `mapstructure:"delay"`
+	MaxDelay           time.Duration   `mapstructure:"max_delay"`
+	LockoutDuration    time.Duration   `mapstructure:"lockout_duration"`
+	MaxLockoutDuration time.Duration   `mapstructure:"max_lockout_duration"`
+	Username           LoginThresholds `mapstructure:"username"`
+	// IP thresholds are usually higher, as many users may share an address
+	IP LoginThresholds `mapstructure:"ip"`
+}
+
+// LoginThresholds holds the failure counts at which logins are delayed and
+// locked, and how many logins may be in flight at once. Zero turns the step
+// off.
+type LoginThresholds struct {
+	DelayAfter  int `mapstructure:"delay_after"`
+	LockAfter   int `mapstructure:"lock_after"`
+	MaxInFlight int `mapstructure:"max_in_flight"`
 }
 
 // LogConfig holds logging-related configuration
 type LogConfig struct {
-	Level  string `mapstructure:"level"`
-	Format string `mapstructure:"format"`
+	Level   string        `mapstructure:"level"`
+	Format  string        `mapstructure:"format"`
+	Capture CaptureConfig `mapstructure:"capture"`
+}
+
+// CaptureConfig holds what the request log records of request and response
+// bodies and headers
+type CaptureConfig struct {
+	// Mode is the capture policy of routes without an override: "off",
+	// "metadata" for sizes and content types only, "redacted" (default) for
+	// headers and bodies with sensitive values masked, or "full" for headers
+	// and bodies as they are
+	Mode string `mapstructure:"mode"`
+	// MaxBodySize is how many bytes of a body are captured, 1024 by default.
+	// Larger bodies are not logged.
+	MaxBodySize int            `mapstructure:"max_body_size"`
+	Redact      RedactConfig   `mapstructure:"redact"`
+	Routes      []CaptureRoute `mapstructure:"routes"`
+}
+
+// RedactConfig holds the values masked in captured headers and bodies. Empty
+// lists fall back to the built-in defaults.
+type RedactConfig struct {
+	// Fields are JSON field paths. A single name such as "password" matches
+	// the field at any depth and a dotted path such as "user.email" matches
+	// from the root. "*" matches any one field, and array elements share the
+	// path of their array. Form fields are matched by name.
+	Fields []string `mapstructure:"fields"`
+	// Headers are header names, matched case-insensitively
+	Headers []string `mapstructure:"headers"`
+	// Patterns are regular expressions masked wherever they match, such as
+	// JWT-shaped strings
+	Patterns []string `mapstructure:"patterns"`
+}
+
+// CaptureRoute overrides the capture policy of a route or route group
+type CaptureRoute struct {
+	// Path is a route such as /api/v1/auth/login, or a group such as
+	// /api/v1/users covering the routes below it. The most specific wins.
+	Path string `mapstructure:"path"`
+	// Method restricts the override to one HTTP method
+	Method string `mapstructure:"method"`
+	Mode   string `mapstructure:"mode"`
+}
+
+// AuthorizationConfig holds role requirements for protected routes
+type AuthorizationConfig struct {
+	// DefaultRoles apply to protected routes without a matching rule. When
+	// empty, any authenticated caller is allowed.
+	DefaultRoles []string `mapstructure:"default_roles"`
+	// RoleClients are the clients whose roles satisfy a required role written
+	// as "client:role", so "users:admin" also matches the "admin" role of the
+	// "users" client when it is listed. Other clients' roles never match.
+	RoleClients []string            `mapstructure:"role_clients"`
+	Rules       []AuthorizationRule `mapstructure:"rules"`
+}
+
+// AuthorizationRule holds the role requirement of a single route
+type AuthorizationRule struct {
+	Method string   `mapstructure:"method"`
+	Path   string   `mapstructure:"path"`
+	Roles  []string `mapstructure:"roles"`
+	// AllowSelf lets callers through when the route's :id matches their subject
+	AllowSelf bool `mapstructure:"allow_self"`
 }
 
 // SecurityConfig holds security-related configuration
 type SecurityConfig struct {
-	CORS      CORSConfig      `mapstructure:"cors"`
-	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	CORS            CORSConfig            `mapstructure:"cors"`
+	RateLimit       RateLimitConfig       `mapstructure:"rate_limit"`
+	Authorization   AuthorizationConfig   `mapstructure:"authorization"`
+	LoginProtection LoginProtectionConfig `mapstructure:"login_protection"`
 }
 
 // IAMConfig holds the configuration for IAM providers
 type IAMConfig struct {
-	Provider string         `mapstructure:"provider"`
-	Keycloak KeycloakConfig `mapstructure:"keycloak"`
+	Provider  string          `mapstructure:"provider"`
+	Keycloak  KeycloakConfig  `mapstructure:"keycloak"`
+	OIDC      OIDCConfig      `mapstructure:"oidc"`
+	Okta      OktaConfig      `mapstructure:"okta"`
+	Auth0     Auth0Config     `mapstructure:"auth0"`
+	Cognito   CognitoConfig   `mapstructure:"cognito"`
+	LDAP      LDAPConfig      `mapstructure:"ldap"`
+	Static    StaticConfig    `mapstructure:"static"`
+	Composite CompositeConfig `mapstructure:"composite"`
 }
 
-// LoadConfig reads configuration from file or environment variables
+// LoadConfig reads configuration from file or environment variables. path is
+// a config file or a directory holding config.yaml. The overlay for the
+// environment named by APP_ENVIRONMENT, such as config.production.yaml next
+// to config.yaml, is merged over it when present.
 func LoadConfig(path string) (*Config, error) {
 	// Load the .env file
 	err := godotenv.Load(".env")
@@ -73,38 +457,149 @@ func LoadConfig(path string) (*Config, error) {
 		log.Printf("No .env file found or error reading .env file: %v", err)
 	}
 
-	// Set up Viper
-	viper.AddConfigPath(path)
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
+	// Read the config files. They are parsed directly rather than by Viper,
+	// which drops keys without a value that environment variables are then
+	// unable to override.
+	base := baseFile(path)
+	settings, err := readSettings(base)
+	if err != nil {
+		return nil, err
+	}
+	sources := []string{base}
+	watched := []string{base}
 
-	// Read the config file
-	if err := viper.ReadInConfig(); err != nil {
-		var configFileNotFoundError viper.ConfigFileNotFoundError
-		if errors.As(err, &configFileNotFoundError) {
-			return nil, fmt.Errorf("config file not found: %w", err)
+	overlay := overlayFile(base, environment(settings))
+	if overlay != "" {
+		watched = append(watched, overlay)
+		overlaySettings, err := readSettings(overlay)
+		switch {
+		case err == nil:
+			mergeSettings(settings, overlaySettings)
+			sources = append(sources, overlay)
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, err
 		}
+	}
+
+	// Expand ${VAR} references, then read _file secrets. Only values written
+	// in the files are expanded: secret file contents, the values substituted
+	// for ${VAR} and environment overrides are used as they are.
+	var problems []FieldError
+	interpolate("", settings, &problems)
+	problems = append(problems, resolveSecretFiles("", settings, reflect.TypeOf(Config{}))...)
+	for _, key := range unknownKeys("", settings, reflect.TypeOf(Config{})) {
+		problems = append(problems, FieldError{Key: key, Message: "unknown key"})
+	}
+
+	// Set up Viper. A dedicated instance lets the configuration be loaded
+	// again on reload without sharing state with a previous load.
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
 	// Enable Viper to read Environment Variables
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
 	// Unmarshal the config into the Config struct
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("error unmarshalling config: %w", err)
 	}
+	config.problems = problems
+	config.sources = sources
+	config.watched = watched
 
 	return &config, nil
 }
 
+// WatchConfig calls onChange whenever one of files is created, written,
+// replaced, renamed or removed. The directories holding the files are watched
+// rather than the files themselves, so files that do not exist yet and files
+// replaced by an editor or a Kubernetes ConfigMap update are still noticed.
+// Events often come in bursts, so callers should debounce.
+func WatchConfig(files []string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error watching config files: %w", err)
+	}
+
+	// targets holds what each file resolves to, so that a symlink swapped to
+	// a new target counts as a change of the file
+	targets := make(map[string]string, len(files))
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		file = filepath.Clean(file)
+		targets[file], _ = filepath.EvalSymlinks(file)
+
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("error watching config directory %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	go func() {
+		for event := range watcher.Events {
+			changed := false
+			for file, target := range targets {
+				current, _ := filepath.EvalSymlinks(file)
+				if current != target {
+					targets[file] = current
+					changed = true
+				}
+				if filepath.Clean(event.Name) == file && event.Op != fsnotify.Chmod {
+					changed = true
+				}
+			}
+			if changed {
+				onChange()
+			}
+		}
+	}()
+	// Errors only report dropped events; the next event or SIGHUP reloads
+	go func() {
+		for range watcher.Errors {
+		}
+	}()
+
+	return nil
+}
+
+// WatchedFiles returns the config files whose changes alter the
+// configuration: the base file and the overlay of its environment, whether or
+// not the overlay exists
+func (c *Config) WatchedFiles() []string {
+	return c.watched
+}
+
+// Sources returns the config files the configuration was read from, the base
+// file first
+func (c *Config) Sources() []string {
+	return c.sources
+}
+
 // CurrentProvider returns the configured IAM provider name
 func (c *IAMConfig) CurrentProvider() string {
 	return strings.ToLower(c.Provider)
 }
 
+// RuleFor returns the rule configured for the given method and route path, or nil
+func (c *AuthorizationConfig) RuleFor(method, path string) *AuthorizationRule {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if strings.EqualFold(rule.Method, method) && rule.Path == path {
+			return rule
+		}
+	}
+	return nil
+}
+
 // IsDebug returns true if the application is in debug mode
 func (c *Config) IsDebug() bool {
 	return c.App.Debug
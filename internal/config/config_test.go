@@ -0,0 +1,235 @@
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+func TestLoadConfigInterpolation(t *testing.T) {
+	t.Setenv("TEST_KEYCLOAK_BASE_URL", "http://keycloak:8080")
+	t.Setenv("TEST_KEYCLOAK_REALM", "")
+
+	cfg := loadConfig(t, `
+app:
+  name: "$${not-a-variable}"
+  port: ${TEST_APP_PORT:-9090}
+iam:
+  keycloak:
+    base_url: ${TEST_KEYCLOAK_BASE_URL}
+    realm: ${TEST_KEYCLOAK_REALM:-master}
+    client_id: ${TEST_UNSET_VARIABLE}
+`)
+
+	if cfg.App.Name != "${not-a-variable}" {
+		t.Errorf("app.name is %q, want the escaped ${ kept", cfg.App.Name)
+	}
+	if cfg.App.Port != 9090 {
+		t.Errorf("app.port is %d, want the default 9090", cfg.App.Port)
+	}
+	if cfg.IAM.Keycloak.BaseURL != "http://keycloak:8080" {
+		t.Errorf("iam.keycloak.base_url is %q, want the environment value", cfg.IAM.Keycloak.BaseURL)
+	}
+	if cfg.IAM.Keycloak.Realm != "master" {
+		t.Errorf("iam.keycloak.realm is %q, want the default for an empty variable", cfg.IAM.Keycloak.Realm)
+	}
+	if cfg.IAM.Keycloak.ClientID != "" {
+		t.Errorf("iam.keycloak.client_id is %q, want it empty for an unset variable", cfg.IAM.Keycloak.ClientID)
+	}
+}
+
+func TestLoadConfigSecretFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "client-secret")
+	if err := os.WriteFile(file, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+
+	cfg := loadConfig(t, fmt.Sprintf(`
+iam:
+  keycloak:
+    client_secret_file: %s
+  okta:
+    client_secret: inline
+    client_secret_file: %s
+  ldap:
+    bind_password_file: %s
+`, file, file, filepath.Join(t.TempDir(), "missing")))
+
+	if got := cfg.IAM.Keycloak.ClientSecret.Value(); got != "s3cr3t" {
+		t.Errorf("iam.keycloak.client_secret is %q, want the file contents without the newline", got)
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate returned no error for conflicting and unreadable secret files")
+	}
+	for _, key := range []string{"iam.okta.client_secret_file", "iam.ldap.bind_password_file"} {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("Validate error %q does not report %s", err, key)
+		}
+	}
+}
+
+func TestLoadConfigDoesNotInterpolateSecrets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "client-secret")
+	if err := os.WriteFile(file, []byte("pa${TEST_SECRET_PART}ss$${x}\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+	t.Setenv("TEST_SECRET_PART", "expanded")
+	t.Setenv("TEST_OKTA_CLIENT_SECRET", "okta${TEST_SECRET_PART}")
+	t.Setenv("IAM_AUTH0_CLIENT_SECRET", "auth0${TEST_SECRET_PART}")
+
+	cfg := loadConfig(t, fmt.Sprintf(`
+iam:
+  keycloak:
+    client_secret_file: %s
+  okta:
+    client_secret: ${TEST_OKTA_CLIENT_SECRET}
+  auth0:
+    client_secret: ""
+`, file))
+
+	for key, tt := range map[string]struct{ got, want string }{
+		"iam.keycloak.client_secret": {cfg.IAM.Keycloak.ClientSecret.Value(), "pa${TEST_SECRET_PART}ss$${x}"},
+		"iam.okta.client_secret":     {cfg.IAM.Okta.ClientSecret.Value(), "okta${TEST_SECRET_PART}"},
+		"iam.auth0.client_secret":    {cfg.IAM.Auth0.ClientSecret.Value(), "auth0${TEST_SECRET_PART}"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s is %q, want %q unexpanded", key, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSecretIsMasked(t *testing.T) {
+	secret := config.Secret("s3cr3t")
+
+	encoded, err := json.Marshal(struct{ Secret config.Secret }{secret})
+	if err != nil {
+		t.Fatalf("json.Marshal returned unexpected error: %v", err)
+	}
+
+	for _, formatted := range []string{
+		fmt.Sprint(secret),
+		fmt.Sprintf("%s %v %+v %#v %q", secret, secret, secret, secret, secret),
+		string(encoded),
+	} {
+		if strings.Contains(formatted, "s3cr3t") {
+			t.Errorf("secret leaked in %q", formatted)
+		}
+	}
+	if secret.Value() != "s3cr3t" {
+		t.Errorf("Value returned %q, want the plain text secret", secret.Value())
+	}
+}
+
+func TestLoadConfigEnvironmentOverlay(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `
+app:
+  environment: development
+  port: 8080
+security:
+  cors:
+    allowed_origins: ["http://localhost:3000", "http://localhost:8080"]
+    allowed_methods: ["GET", "POST"]
+`,
+		"config.production.yaml": `
+app:
+  port: 443
+security:
+  cors:
+    allowed_origins: ["https://app.example.com"]
+`,
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	t.Setenv("APP_ENVIRONMENT", "production")
+
+	cfg, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig returned unexpected error: %v", err)
+	}
+
+	if cfg.App.Port != 443 {
+		t.Errorf("app.port is %d, want the overlay value 443", cfg.App.Port)
+	}
+	if want := []string{"https://app.example.com"}; !reflect.DeepEqual(cfg.Security.CORS.AllowedOrigins, want) {
+		t.Errorf("allowed_origins is %v, want the overlay list %v", cfg.Security.CORS.AllowedOrigins, want)
+	}
+	if want := []string{"GET", "POST"}; !reflect.DeepEqual(cfg.Security.CORS.AllowedMethods, want) {
+		t.Errorf("allowed_methods is %v, want the base list %v kept", cfg.Security.CORS.AllowedMethods, want)
+	}
+	if sources := cfg.Sources(); len(sources) != 2 || filepath.Base(sources[1]) != "config.production.yaml" {
+		t.Errorf("Sources returned %v, want config.yaml and config.production.yaml", sources)
+	}
+}
+
+func TestWatchConfigNoticesNewOverlay(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(base, []byte("app:\n  port: 8080\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config.yaml: %v", err)
+	}
+	t.Setenv("APP_ENVIRONMENT", "production")
+
+	cfg, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig returned unexpected error: %v", err)
+	}
+	if len(cfg.Sources()) != 1 {
+		t.Fatalf("Sources returned %v, want only config.yaml", cfg.Sources())
+	}
+
+	changes := make(chan struct{}, 16)
+	if err := config.WatchConfig(cfg.WatchedFiles(), func() { changes <- struct{}{} }); err != nil {
+		t.Fatalf("WatchConfig returned unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("unrelated"), 0o600); err != nil {
+		t.Fatalf("failed to write notes.txt: %v", err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("WatchConfig reported a change of an unrelated file")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "config.production.yaml"), []byte("app:\n  port: 443\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config.production.yaml: %v", err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchConfig did not report the new overlay")
+	}
+}
+
+func TestWriteYAMLMasksSecrets(t *testing.T) {
+	cfg := loadConfig(t, `
+iam:
+  keycloak:
+    client_secret: s3cr3t
+`)
+
+	var out strings.Builder
+	if err := cfg.WriteYAML(&out); err != nil {
+		t.Fatalf("WriteYAML returned unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("WriteYAML leaked the secret:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "client_secret: '[REDACTED]'") {
+		t.Errorf("WriteYAML output does not mask client_secret:\n%s", out.String())
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// durationType is the reflect.Type of time.Duration
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// WriteYAML writes the configuration to w as YAML, with the keys of the
+// config file and secrets masked
+func (c *Config) WriteYAML(w io.Writer) error {
+	node, err := yamlNode(reflect.ValueOf(*c))
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return encoder.Close()
+}
+
+// yamlNode converts value into a YAML node, naming struct fields after their
+// mapstructure tags and keeping them in declaration order
+func yamlNode(value reflect.Value) (*yaml.Node, error) {
+	switch {
+	case value.Type() == durationType:
+		return scalarNode(time.Duration(value.Int()).String()), nil
+	case value.Type() == secretType:
+		return scalarNode(Secret(value.String()).String()), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			key := field.Tag.Get("mapstructure")
+			if key == "" || !field.IsExported() {
+				continue
+			}
+
+			child, err := yamlNode(value.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, scalarNode(key), child)
+		}
+		return node, nil
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode, Style: flowStyle(value.Len())}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, key := range keys {
+			child, err := yamlNode(value.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, scalarNode(key.String()), child)
+		}
+		return node, nil
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: flowStyle(value.Len())}
+		for i := 0; i < value.Len(); i++ {
+			child, err := yamlNode(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value.Interface()); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// scalarNode returns a YAML string node holding value
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// flowStyle writes empty blocks and lists inline, as {} and []
+func flowStyle(length int) yaml.Style {
+	if length == 0 {
+		return yaml.FlowStyle
+	}
+	return 0
+}
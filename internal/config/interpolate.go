@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// interpolate expands environment variables in every string in settings,
+// recording problems under their key path. Keys are left untouched. It must
+// run before secret files are read so their contents are never expanded.
+func interpolate(prefix string, settings interface{}, problems *[]FieldError) interface{} {
+	switch value := settings.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			value[key] = interpolate(prefix+key+".", nested, problems)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = interpolate(fmt.Sprintf("%s[%d].", strings.TrimSuffix(prefix, "."), i), nested, problems)
+		}
+	case string:
+		expanded, err := expandEnv(value)
+		if err != nil {
+			*problems = append(*problems, FieldError{Key: strings.TrimSuffix(prefix, "."), Message: err.Error()})
+			return value
+		}
+		return expanded
+	}
+	return settings
+}
+
+// expandEnv replaces ${VAR} with the value of the environment variable VAR,
+// and ${VAR:-default} with default when VAR is unset or empty. $${ is kept as
+// a literal ${. Substituted values are not expanded again.
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", errors.New("unterminated ${ in value")
+		}
+		name, fallback, hasFallback := strings.Cut(s[i+2:i+end], ":-")
+		if !isEnvName(name) {
+			return "", fmt.Errorf("invalid environment variable name %q", name)
+		}
+
+		value := os.Getenv(name)
+		if value == "" && hasFallback {
+			value = fallback
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// isEnvName reports whether name is a valid environment variable name
+func isEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// baseFile returns the config file for path, which is either the file itself
+// or a directory holding config.yaml
+func baseFile(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, "config.yaml")
+	}
+	return path
+}
+
+// overlayFile returns the overlay of base for environment, e.g.
+// config.production.yaml for config.yaml, or "" without an environment
+func overlayFile(base, environment string) string {
+	if environment == "" {
+		return ""
+	}
+
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + environment + ext
+}
+
+// environment returns the environment whose overlay is loaded: APP_ENVIRONMENT,
+// or app.environment in the base settings
+func environment(settings map[string]interface{}) string {
+	env := os.Getenv("APP_ENVIRONMENT")
+	if env == "" {
+		if app, ok := settings["app"].(map[string]interface{}); ok {
+			env, _ = app["environment"].(string)
+			env, _ = expandEnv(env)
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(env))
+}
+
+// readSettings parses the YAML config file at path into nested maps
+func readSettings(path string) (map[string]interface{}, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("config file not found: %w", err)
+		}
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	settings := make(map[string]interface{})
+	if err := yaml.Unmarshal(contents, &settings); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// mergeSettings deep merges overlay into base. Blocks are merged key by key;
+// any other value, lists included, replaces the one in base.
+func mergeSettings(base, overlay map[string]interface{}) {
+	for key, value := range overlay {
+		overlayBlock, ok := value.(map[string]interface{})
+		if baseBlock, isBlock := base[key].(map[string]interface{}); ok && isBlock {
+			mergeSettings(baseBlock, overlayBlock)
+			continue
+		}
+		base[key] = value
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces secret values when they are formatted or encoded
+const redacted = "[REDACTED]"
+
+// secretFileSuffix marks keys that name a file holding the value of a secret,
+// e.g. client_secret_file for client_secret
+const secretFileSuffix = "_file"
+
+// Secret is a configuration value, such as a client secret or password, that
+// is masked whenever it is formatted, logged or encoded. Use Value to read it.
+type Secret string
+
+// Value returns the secret in plain text
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String masks the secret. An unset secret stays empty, so it can be told apart.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString masks the secret in %#v output
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+// MarshalText masks the secret in JSON and YAML output
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// secretType is the reflect.Type of Secret
+var secretType = reflect.TypeOf(Secret(""))
+
+// resolveSecretFiles replaces every <key>_file in settings whose <key> is a
+// Secret field of t with <key>, set to the contents of the named file. The
+// trailing newline most secret files end with is trimmed.
+func resolveSecretFiles(prefix string, settings interface{}, t reflect.Type) []FieldError {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var problems []FieldError
+	switch t.Kind() {
+	case reflect.Struct:
+		values, ok := settings.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range values {
+			name, isFile := strings.CutSuffix(key, secretFileSuffix)
+			if field, ok := fieldByKey(t, name); isFile && ok && field.Type == secretType {
+				problems = append(problems, resolveSecretFile(prefix, values, name, value)...)
+				continue
+			}
+			if field, ok := fieldByKey(t, key); ok {
+				problems = append(problems, resolveSecretFiles(prefix+key+".", value, field.Type)...)
+			}
+		}
+	case reflect.Map:
+		values, ok := settings.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range values {
+			problems = append(problems, resolveSecretFiles(prefix+key+".", value, t.Elem())...)
+		}
+	case reflect.Slice:
+		values, ok := settings.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, value := range values {
+			problems = append(problems, resolveSecretFiles(fmt.Sprintf("%s[%d].", strings.TrimSuffix(prefix, "."), i), value, t.Elem())...)
+		}
+	}
+	return problems
+}
+
+// resolveSecretFile sets values[name] to the contents of the file named by
+// values[name+"_file"]. Problems never include the secret itself.
+func resolveSecretFile(prefix string, values map[string]interface{}, name string, path interface{}) []FieldError {
+	key := prefix + name + secretFileSuffix
+	delete(values, name+secretFileSuffix)
+
+	file, _ := path.(string)
+	if file == "" {
+		return nil
+	}
+	if current, _ := values[name].(string); current != "" {
+		return []FieldError{{Key: key, Message: fmt.Sprintf("cannot be combined with %s", prefix+name)}}
+	}
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return []FieldError{{Key: key, Message: fmt.Sprintf("failed to read secret file: %v", err)}}
+	}
+	values[name] = strings.TrimRight(string(contents), "\r\n")
+
+	return nil
+}
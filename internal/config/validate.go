@@ -0,0 +1,566 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MinSessionSigningKeyLength is the minimum HS256 session signing key size, in bytes
+const MinSessionSigningKeyLength = 32
+
+// providers lists the supported values of iam.provider
+var providers = []string{"keycloak", "oidc", "okta", "auth0", "cognito", "ldap", "static", "composite"}
+
+// captureModes lists the capture policies of the request log
+var captureModes = []string{"off", "metadata", "redacted", "full"}
+
+// FieldError is a problem with a single configuration key
+type FieldError struct {
+	// Key is the dotted key path, e.g. "iam.keycloak.base_url"
+	Key     string
+	Message string
+}
+
+// Error implements the error interface
+func (e FieldError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []FieldError
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.Error()
+	}
+	return strings.Join(problems, "; ")
+}
+
+// validator collects the problems found while validating a configuration
+type validator struct {
+	problems []FieldError
+}
+
+// Validate checks the whole configuration and reports every problem found as
+// a *ValidationError, sorted by key
+func (c *Config) Validate() error {
+	v := &validator{problems: append([]FieldError{}, c.problems...)}
+
+	if c.App.Port < 1 || c.App.Port > 65535 {
+		v.addf("app.port", "must be between 1 and 65535")
+	}
+	for i, proxy := range c.App.TrustedProxies {
+		v.ipOrCIDR(fmt.Sprintf("app.trusted_proxies[%d]", i), proxy)
+	}
+	c.IAM.validate(v)
+	c.Security.validate(v)
+	c.Tenancy.validate(v)
+	v.oneOf("logging.level", c.Logging.Level, "debug", "info", "warn", "error")
+	v.oneOf("logging.format", c.Logging.Format, "json", "console")
+	c.Logging.Capture.validate(v)
+
+	return v.err()
+}
+
+// validate checks the selected provider and, for the composite provider, the
+// providers it chains. Blocks of unused providers are not checked.
+func (c *IAMConfig) validate(v *validator) {
+	name := c.CurrentProvider()
+	if !v.required("iam.provider", name) || !v.oneOf("iam.provider", name, providers...) {
+		return
+	}
+
+	if name == "composite" {
+		c.validateComposite(v)
+		return
+	}
+	c.validateProvider(v, name)
+}
+
+// validateProvider checks the block of the named provider
+func (c *IAMConfig) validateProvider(v *validator, name string) {
+	switch name {
+	case "keycloak":
+		c.Keycloak.validate(v, "iam.keycloak")
+	case "oidc":
+		c.OIDC.validate(v, "iam.oidc")
+	case "okta":
+		c.Okta.validate(v, "iam.okta")
+	case "auth0":
+		c.Auth0.validate(v, "iam.auth0")
+	case "cognito":
+		c.Cognito.validate(v, "iam.cognito")
+	case "ldap":
+		c.LDAP.validate(v, "iam.ldap")
+	case "static":
+		c.Static.validate(v, "iam.static")
+	}
+}
+
+// validateComposite checks the composite block and the block of every backend
+func (c *IAMConfig) validateComposite(v *validator) {
+	composite := c.Composite
+	v.oneOf("iam.composite.strategy", composite.Strategy, "first-success", "primary-with-fallback", "route-by-username-domain")
+	v.nonNegative("iam.composite.health_check_interval", composite.HealthCheckInterval)
+
+	if len(composite.Backends) == 0 {
+		v.addf("iam.composite.backends", "must list at least one backend")
+		return
+	}
+
+	seen := make(map[string]int)
+	for i, backend := range composite.Backends {
+		key := fmt.Sprintf("iam.composite.backends[%d].provider", i)
+		name := strings.ToLower(backend.Provider)
+		if !v.required(key, name) || !v.oneOf(key, name, providers...) {
+			continue
+		}
+		if name == "composite" {
+			v.addf(key, "cannot chain the composite provider")
+			continue
+		}
+		if j, ok := seen[name]; ok {
+			v.addf(key, "duplicates backends[%d]", j)
+			continue
+		}
+		seen[name] = i
+
+		c.validateProvider(v, name)
+	}
+}
+
+// validate checks the Keycloak block. The default realm may be left out when
+// tenants are configured.
+func (c *KeycloakConfig) validate(v *validator, prefix string) {
+	hasDefault := c.Realm != "" || c.ClientID != "" || c.ClientSecret != ""
+	if hasDefault || len(c.Tenants) == 0 {
+		v.requiredURL(prefix+".base_url", c.BaseURL)
+		v.required(prefix+".realm", c.Realm)
+		v.required(prefix+".client_id", c.ClientID)
+		v.required(prefix+".client_secret", c.ClientSecret.Value())
+	} else if c.BaseURL != "" {
+		v.httpURL(prefix+".base_url", c.BaseURL)
+	}
+	c.TokenValidation.validate(v, prefix+".token_validation", "remote", "local")
+
+	for id, tenant := range c.Tenants {
+		tenantPrefix := prefix + ".tenants." + id
+		if tenant.BaseURL != "" {
+			v.httpURL(tenantPrefix+".base_url", tenant.BaseURL)
+		} else if c.BaseURL == "" {
+			v.addf(tenantPrefix+".base_url", "is required when %s.base_url is empty", prefix)
+		}
+		v.required(tenantPrefix+".realm", tenant.Realm)
+		v.required(tenantPrefix+".client_id", tenant.ClientID)
+		v.required(tenantPrefix+".client_secret", tenant.ClientSecret.Value())
+	}
+}
+
+// validate checks the OIDC block
+func (c *OIDCConfig) validate(v *validator, prefix string) {
+	v.requiredURL(prefix+".issuer", c.Issuer)
+	v.required(prefix+".client_id", c.ClientID)
+	v.oneOf(prefix+".token_endpoint_auth_method", c.TokenEndpointAuthMethod, "client_secret_basic", "client_secret_post")
+	c.TokenValidation.validate(v, prefix+".token_validation", "remote", "local")
+}
+
+// validate checks the Okta block
+func (c *OktaConfig) validate(v *validator, prefix string) {
+	v.requiredURL(prefix+".org_url", c.OrgURL)
+	v.required(prefix+".client_id", c.ClientID)
+	if c.Management.APIToken == "" {
+		if c.Management.ClientID == "" && c.Management.PrivateKey == "" {
+			v.addf(prefix+".management.api_token", "is required unless client_id and private_key are set")
+		} else {
+			v.required(prefix+".management.client_id", c.Management.ClientID)
+			v.required(prefix+".management.private_key", c.Management.PrivateKey.Value())
+		}
+	}
+	c.TokenValidation.validate(v, prefix+".token_validation", "remote", "local")
+}
+
+// validate checks the Auth0 block
+func (c *Auth0Config) validate(v *validator, prefix string) {
+	v.required(prefix+".domain", c.Domain)
+	v.required(prefix+".client_id", c.ClientID)
+	v.required(prefix+".client_secret", c.ClientSecret.Value())
+	if c.Management.ClientID != "" {
+		v.required(prefix+".management.client_secret", c.Management.ClientSecret.Value())
+	}
+	c.TokenValidation.validate(v, prefix+".token_validation", "remote", "local")
+}
+
+// validate checks the Cognito block
+func (c *CognitoConfig) validate(v *validator, prefix string) {
+	v.required(prefix+".region", c.Region)
+	v.required(prefix+".user_pool_id", c.UserPoolID)
+	v.required(prefix+".client_id", c.ClientID)
+	if c.Endpoint != "" {
+		v.httpURL(prefix+".endpoint", c.Endpoint)
+	}
+	if c.AccessKeyID != "" {
+		v.required(prefix+".secret_access_key", c.SecretAccessKey.Value())
+	}
+	c.TokenValidation.validate(v, prefix+".token_validation", "local")
+}
+
+// validate checks the LDAP block
+func (c *LDAPConfig) validate(v *validator, prefix string) {
+	if v.required(prefix+".url", c.URL) {
+		serverURL, err := url.Parse(c.URL)
+		switch {
+		case err != nil || (serverURL.Scheme != "ldap" && serverURL.Scheme != "ldaps") || serverURL.Host == "":
+			v.addf(prefix+".url", "must be an ldap:// or ldaps:// URL")
+		case c.StartTLS && serverURL.Scheme == "ldaps":
+			v.addf(prefix+".start_tls", "cannot be combined with an ldaps:// URL")
+		}
+	}
+	v.required(prefix+".bind_dn", c.BindDN)
+	v.required(prefix+".user_base_dn", c.UserBaseDN)
+	if c.Pool.Size < 0 {
+		v.addf(prefix+".pool.size", "must not be negative")
+	}
+	v.nonNegative(prefix+".pool.dial_timeout", c.Pool.DialTimeout)
+	c.Session.validate(v, prefix+".session")
+}
+
+// validate checks the static block. Users in the users file are checked when
+// the provider loads it.
+func (c *StaticConfig) validate(v *validator, prefix string) {
+	if c.Persist && c.File == "" {
+		v.addf(prefix+".file", "is required when persist is enabled")
+	}
+	if c.Persist && len(c.Users) > 0 {
+		v.addf(prefix+".users", "cannot be combined with persist")
+	}
+	for i, user := range c.Users {
+		userPrefix := fmt.Sprintf("%s.users[%d]", prefix, i)
+		v.required(userPrefix+".username", user.Username)
+		v.required(userPrefix+".password_hash", user.PasswordHash)
+	}
+	c.Session.validate(v, prefix+".session")
+}
+
+// validate checks a session token block
+func (c *SessionTokenConfig) validate(v *validator, prefix string) {
+	if len(c.SigningKey) < MinSessionSigningKeyLength {
+		v.addf(prefix+".signing_key", "must be at least %d bytes", MinSessionSigningKeyLength)
+	}
+	v.nonNegative(prefix+".access_token_ttl", c.AccessTokenTTL)
+	v.nonNegative(prefix+".refresh_token_ttl", c.RefreshTokenTTL)
+}
+
+// validate checks a token validation block against the modes the provider supports
+func (c *TokenValidationConfig) validate(v *validator, prefix string, modes ...string) {
+	v.oneOf(prefix+".mode", c.Mode, modes...)
+	if c.Issuer != "" {
+		v.httpURL(prefix+".issuer", c.Issuer)
+	}
+	v.nonNegative(prefix+".clock_skew", c.ClockSkew)
+	v.nonNegative(prefix+".jwks_cache_ttl", c.JWKSCacheTTL)
+	v.nonNegative(prefix+".jwks_min_refresh_interval", c.JWKSMinRefreshInterval)
+}
+
+// validate checks the CORS, rate limit and authorization settings
+func (c *SecurityConfig) validate(v *validator) {
+	for i, origin := range c.CORS.AllowedOrigins {
+		if origin != "*" {
+			v.httpURL(fmt.Sprintf("security.cors.allowed_origins[%d]", i), origin)
+		}
+	}
+	for i, method := range c.CORS.AllowedMethods {
+		v.method(fmt.Sprintf("security.cors.allowed_methods[%d]", i), method)
+	}
+
+	c.RateLimit.validate(v)
+	c.LoginProtection.validate(v)
+
+	seen := make(map[string]int)
+	for i, rule := range c.Authorization.Rules {
+		prefix := fmt.Sprintf("security.authorization.rules[%d]", i)
+		if v.required(prefix+".method", rule.Method) {
+			v.method(prefix+".method", rule.Method)
+		}
+		if v.required(prefix+".path", rule.Path) && !strings.HasPrefix(rule.Path, "/") {
+			v.addf(prefix+".path", "must start with /")
+		}
+
+		route := strings.ToUpper(rule.Method) + " " + rule.Path
+		if j, ok := seen[route]; ok {
+			v.addf(prefix, "duplicates rules[%d]", j)
+			continue
+		}
+		seen[route] = i
+	}
+}
+
+// validate checks the rate limit and its route overrides
+func (c *RateLimitConfig) validate(v *validator) {
+	if !c.Enabled {
+		return
+	}
+
+	if c.RequestsPerSecond <= 0 {
+		v.addf("security.rate_limit.requests_per_second", "must be positive when rate limiting is enabled")
+	}
+	if c.Burst < 0 {
+		v.addf("security.rate_limit.burst", "must not be negative")
+	}
+	v.oneOf("security.rate_limit.key", c.Key, "ip", "subject", "client")
+	if c.PreAuth.RequestsPerSecond < 0 {
+		v.addf("security.rate_limit.pre_auth.requests_per_second", "must not be negative")
+	}
+	if c.PreAuth.Burst < 0 {
+		v.addf("security.rate_limit.pre_auth.burst", "must not be negative")
+	}
+	v.oneOf("security.rate_limit.store.failure_mode", c.Store.FailureMode, "open", "closed")
+	if v.oneOf("security.rate_limit.store.type", c.Store.Type, "memory", "redis") && strings.EqualFold(c.Store.Type, "redis") {
+		v.required("security.rate_limit.store.redis.address", c.Store.Redis.Address)
+		if c.Store.Redis.DB < 0 {
+			v.addf("security.rate_limit.store.redis.db", "must not be negative")
+		}
+		v.nonNegative("security.rate_limit.store.redis.timeout", c.Store.Redis.Timeout)
+	}
+
+	for i, route := range c.Routes {
+		prefix := fmt.Sprintf("security.rate_limit.routes[%d]", i)
+		if v.required(prefix+".path", route.Path) && !strings.HasPrefix(route.Path, "/") {
+			v.addf(prefix+".path", "must start with /")
+		}
+		if route.Method != "" {
+			v.method(prefix+".method", route.Method)
+		}
+		if route.RequestsPerSecond <= 0 {
+			v.addf(prefix+".requests_per_second", "must be positive")
+		}
+		if route.Burst < 0 {
+			v.addf(prefix+".burst", "must not be negative")
+		}
+		v.oneOf(prefix+".key", route.Key, "ip", "subject", "client")
+	}
+}
+
+// validate checks the login protection thresholds and durations
+func (c *LoginProtectionConfig) validate(v *validator) {
+	if !c.Enabled {
+		return
+	}
+
+	for key, d := range map[string]time.Duration{
+		"window":               c.Window,
+		"delay":                c.Delay,
+		"max_delay":            c.MaxDelay,
+		"lockout_duration":     c.LockoutDuration,
+		"max_lockout_duration": c.MaxLockoutDuration,
+	} {
+		v.nonNegative("security.login_protection."+key, d)
+	}
+	if c.MaxDelay > 0 && c.MaxDelay < c.Delay {
+		v.addf("security.login_protection.max_delay", "must not be less than delay")
+	}
+	if c.MaxLockoutDuration > 0 && c.MaxLockoutDuration < c.LockoutDuration {
+		v.addf("security.login_protection.max_lockout_duration", "must not be less than lockout_duration")
+	}
+
+	for name, thresholds := range map[string]LoginThresholds{"username": c.Username, "ip": c.IP} {
+		prefix := "security.login_protection." + name
+		if thresholds.DelayAfter < 0 {
+			v.addf(prefix+".delay_after", "must not be negative")
+		}
+		if thresholds.LockAfter < 0 {
+			v.addf(prefix+".lock_after", "must not be negative")
+		}
+		if thresholds.MaxInFlight < 0 {
+			v.addf(prefix+".max_in_flight", "must not be negative")
+		}
+		if thresholds.LockAfter > 0 && thresholds.DelayAfter > thresholds.LockAfter {
+			v.addf(prefix+".delay_after", "must not be greater than lock_after")
+		}
+	}
+}
+
+// validate checks the capture policies and redaction patterns of the request log
+func (c *CaptureConfig) validate(v *validator) {
+	v.oneOf("logging.capture.mode", c.Mode, captureModes...)
+	if c.MaxBodySize < 0 {
+		v.addf("logging.capture.max_body_size", "must not be negative")
+	}
+
+	for i, field := range c.Redact.Fields {
+		if strings.TrimSpace(field) == "" || strings.Contains(field, "..") {
+			v.addf(fmt.Sprintf("logging.capture.redact.fields[%d]", i), "must be a field name or dotted path")
+		}
+	}
+	for i, pattern := range c.Redact.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			v.addf(fmt.Sprintf("logging.capture.redact.patterns[%d]", i), "must be a valid regular expression: %v", err)
+		}
+	}
+
+	for i, route := range c.Routes {
+		prefix := fmt.Sprintf("logging.capture.routes[%d]", i)
+		if v.required(prefix+".path", route.Path) && !strings.HasPrefix(route.Path, "/") {
+			v.addf(prefix+".path", "must start with /")
+		}
+		if route.Method != "" {
+			v.method(prefix+".method", route.Method)
+		}
+		if v.required(prefix+".mode", route.Mode) {
+			v.oneOf(prefix+".mode", route.Mode, captureModes...)
+		}
+	}
+}
+
+// validate checks how tenants are resolved
+func (c *TenancyConfig) validate(v *validator) {
+	if !v.oneOf("tenancy.mode", c.Mode, "header", "subdomain", "path") {
+		return
+	}
+	if strings.EqualFold(c.Mode, "subdomain") {
+		v.required("tenancy.base_domain", c.BaseDomain)
+	}
+}
+
+// addf records a problem with key
+func (v *validator) addf(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// required records a problem when value is empty and reports whether it is set
+func (v *validator) required(key, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.addf(key, "is required")
+		return false
+	}
+	return true
+}
+
+// requiredURL checks that value is set and is an absolute http(s) URL
+func (v *validator) requiredURL(key, value string) {
+	if v.required(key, value) {
+		v.httpURL(key, value)
+	}
+}
+
+// httpURL records a problem when value is not an absolute http(s) URL
+func (v *validator) httpURL(key, value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.addf(key, "must be an absolute http(s) URL")
+	}
+}
+
+// oneOf records a problem when value is set and is none of allowed, compared
+// case-insensitively, and reports whether value is acceptable
+func (v *validator) oneOf(key, value string, allowed ...string) bool {
+	if value == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return true
+		}
+	}
+	v.addf(key, "must be one of %s", strings.Join(allowed, ", "))
+	return false
+}
+
+// method records a problem when value is not an HTTP method
+func (v *validator) method(key, value string) {
+	v.oneOf(key, value, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions)
+}
+
+// ipOrCIDR records a problem when value is neither an IP nor a CIDR
+func (v *validator) ipOrCIDR(key, value string) {
+	if net.ParseIP(value) != nil {
+		return
+	}
+	if _, _, err := net.ParseCIDR(value); err != nil {
+		v.addf(key, "must be an IP address or CIDR")
+	}
+}
+
+// nonNegative records a problem when d is negative
+func (v *validator) nonNegative(key string, d time.Duration) {
+	if d < 0 {
+		v.addf(key, "must not be negative")
+	}
+}
+
+// err returns the problems found as a *ValidationError, or nil
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		return v.problems[i].Key < v.problems[j].Key
+	})
+	return &ValidationError{Problems: v.problems}
+}
+
+// unknownKeys returns the dotted paths of keys in settings that do not map
+// onto a field of t, descending into nested blocks, maps and lists
+func unknownKeys(prefix string, settings interface{}, t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var keys []string
+	switch t.Kind() {
+	case reflect.Struct:
+		values, ok := settings.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range values {
+			field, ok := fieldByKey(t, key)
+			if !ok {
+				keys = append(keys, prefix+key)
+				continue
+			}
+			keys = append(keys, unknownKeys(prefix+key+".", value, field.Type)...)
+		}
+	case reflect.Map:
+		values, ok := settings.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range values {
+			keys = append(keys, unknownKeys(prefix+key+".", value, t.Elem())...)
+		}
+	case reflect.Slice:
+		values, ok := settings.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, value := range values {
+			keys = append(keys, unknownKeys(fmt.Sprintf("%s[%d].", strings.TrimSuffix(prefix, "."), i), value, t.Elem())...)
+		}
+	}
+	return keys
+}
+
+// fieldByKey finds the field of t whose mapstructure tag matches key
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name != "" && strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,117 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// loadConfig writes contents to a config.yaml in a temporary directory and loads it
+func loadConfig(t *testing.T, contents string) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig returned unexpected error: %v", err)
+	}
+	return cfg
+}
+
+// problemKeys validates cfg and returns the keys of the problems found
+func problemKeys(t *testing.T, cfg *config.Config) []string {
+	t.Helper()
+
+	err := cfg.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate returned %T, want *config.ValidationError", err)
+	}
+
+	keys := make([]string, len(validationErr.Problems))
+	for i, problem := range validationErr.Problems {
+		keys[i] = problem.Key
+	}
+	return keys
+}
+
+func TestValidateValid(t *testing.T) {
+	cfg := loadConfig(t, `
+app:
+  port: 8080
+  trusted_proxies: [10.0.0.1, 10.1.0.0/16, "2001:db8::/32"]
+iam:
+  provider: keycloak
+  keycloak:
+    base_url: http://localhost:8180
+    realm: master
+    client_id: iam-bridge
+    client_secret: secret
+    tenants:
+      acme:
+        realm: acme
+        client_id: iam-bridge
+        client_secret: secret
+`)
+
+	if keys := problemKeys(t, cfg); keys != nil {
+		t.Errorf("Validate reported problems with %v, want none", keys)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := loadConfig(t, `
+app:
+  port: 0
+  trusted_proxies: [10.0.0.0/8, proxy.internal]
+iam:
+  provider: composite
+  composite:
+    strategy: round-robin
+    backends:
+      - provider: ldap
+      - provider: ldap
+  ldap:
+    url: ldaps://ldap.example.com
+    start_tls: true
+    bind_dn: cn=iam-bridge
+    user_base_dn: ou=people
+    session:
+      signing_key: short
+security:
+  authorization:
+    rules:
+      - method: GET
+        path: users/:id
+        rolez: ["users:admin"]
+tenancy:
+  mode: subdomain
+`)
+
+	want := []string{
+		"app.port",
+		"app.trusted_proxies[1]",
+		"iam.composite.backends[1].provider",
+		"iam.composite.strategy",
+		"iam.ldap.session.signing_key",
+		"iam.ldap.start_tls",
+		"security.authorization.rules[0].path",
+		"security.authorization.rules[0].rolez",
+		"tenancy.base_domain",
+	}
+	if keys := problemKeys(t, cfg); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Validate reported problems with %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,394 @@
+// Package lockout protects logins against brute force and credential stuffing
+// by delaying and then refusing logins after repeated failures, counted per
+// username and per IP
+package lockout
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+const (
+	// sweepInterval is how often expired counters are evicted
+	sweepInterval = time.Minute
+
+	defaultWindow          = 15 * time.Minute
+	defaultDelay           = time.Second
+	defaultMaxDelay        = 10 * time.Second
+	defaultLockoutDuration = 15 * time.Minute
+	defaultMaxLockout      = 24 * time.Hour
+)
+
+var (
+	// ErrLocked is returned when logins are refused after too many failures
+	ErrLocked = errors.New("login locked")
+	// ErrBusy is returned when logins are refused because too many attempts
+	// for the username or IP are already in flight
+	ErrBusy = errors.New("too many logins in flight")
+	// ErrNotFound is returned when clearing a username or IP without failures
+	ErrNotFound = errors.New("lockout not found")
+)
+
+// Kind is what failures are counted against
+type Kind string
+
+const (
+	// KindUsername counts failures per username and tenant
+	KindUsername Kind = "username"
+	// KindIP counts failures per client IP, across tenants
+	KindIP Kind = "ip"
+)
+
+// Attempt identifies a login attempt
+type Attempt struct {
+	Tenant   string
+	Username string
+	IP       string
+}
+
+// Decision is what to do with a login attempt
+type Decision struct {
+	// Delay is how long to wait before passing the attempt on
+	Delay time.Duration
+	// RetryAfter is how long until logins are accepted again, when locked
+	RetryAfter time.Duration
+	// Busy is set when the attempt must be refused because too many attempts
+	// are already in flight
+	Busy bool
+}
+
+// Locked reports whether the attempt must be refused for past failures
+func (d Decision) Locked() bool {
+	return d.RetryAfter > 0
+}
+
+// Lockout describes a username or IP that logins are refused for
+type Lockout struct {
+	Kind        Kind      `json:"kind"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Subject     string    `json:"subject"`
+	LockedUntil time.Time `json:"locked_until"`
+	// Lockouts counts the lockouts in a row, which lengthen each time
+	Lockouts int `json:"lockouts"`
+}
+
+// key identifies a counter
+type key struct {
+	kind    Kind
+	tenant  string
+	subject string
+}
+
+// counter holds the recent failures of a username or IP
+type counter struct {
+	failures int
+	// pending counts the attempts in flight
+	pending     int
+	lockouts    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Tracker counts failed logins in process memory. Counters are forgotten a
+// window after the last failure or lockout, so memory stays bounded by the
+// usernames and IPs failing recently.
+type Tracker struct {
+	mu        sync.Mutex
+	cfg       config.LoginProtectionConfig
+	counters  map[key]*counter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewTracker creates a new Tracker
+func NewTracker(cfg config.LoginProtectionConfig) *Tracker {
+	t := &Tracker{
+		counters:  make(map[key]*counter),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+	t.Configure(cfg)
+	return t
+}
+
+// Configure replaces the configuration, keeping the failures counted so far
+func (t *Tracker) Configure(cfg config.LoginProtectionConfig) {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+	if cfg.Delay <= 0 {
+		cfg.Delay = defaultDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultMaxDelay
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = defaultLockoutDuration
+	}
+	if cfg.MaxLockoutDuration <= 0 {
+		cfg.MaxLockoutDuration = defaultMaxLockout
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cfg = cfg
+}
+
+// Begin decides whether the attempt may go ahead and how long it is delayed.
+// Unless it is refused, the attempt counts against the in-flight limits until
+// done is called with whether it failed for invalid credentials. done must be
+// called exactly once; it does nothing for refused attempts.
+func (t *Tracker) Begin(attempt Attempt) (decision Decision, done func(failed bool)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	done = func(bool) {}
+	if !t.cfg.Enabled {
+		return decision, done
+	}
+
+	now := t.now()
+	if now.Sub(t.lastSweep) >= sweepInterval {
+		t.sweep(now)
+	}
+
+	keys := t.keys(attempt)
+	decision = t.decide(keys, now)
+	if decision.Locked() || decision.Busy {
+		return decision, done
+	}
+
+	for _, k := range keys {
+		c := t.counter(k, now)
+		if c == nil {
+			c = &counter{}
+			t.counters[k] = c
+		}
+		c.pending++
+	}
+
+	var once sync.Once
+	done = func(failed bool) {
+		once.Do(func() {
+			t.finish(keys, failed)
+		})
+	}
+	return decision, done
+}
+
+// Check returns the decision Begin would make for the attempt, without
+// reserving it
+func (t *Tracker) Check(attempt Attempt) Decision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.cfg.Enabled {
+		return Decision{}
+	}
+	return t.decide(t.keys(attempt), t.now())
+}
+
+// decide returns the decision for an attempt checked against keys. Only
+// recorded failures delay and lock logins; attempts in flight are checked
+// against MaxInFlight alone.
+func (t *Tracker) decide(keys []key, now time.Time) Decision {
+	var decision Decision
+	for _, k := range keys {
+		c := t.counter(k, now)
+		if c == nil {
+			continue
+		}
+
+		thresholds := t.thresholds(k.kind)
+		if retryAfter := c.lockedUntil.Sub(now); retryAfter > decision.RetryAfter {
+			decision.RetryAfter = retryAfter
+		}
+		if delay := t.delay(k.kind, c.failures); delay > decision.Delay {
+			decision.Delay = delay
+		}
+		if thresholds.MaxInFlight > 0 && c.pending >= thresholds.MaxInFlight {
+			decision.Busy = true
+		}
+	}
+	return decision
+}
+
+// finish releases a reserved attempt and records it when it failed, locking
+// the username or IP once it reaches its threshold
+func (t *Tracker) finish(keys []key, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for _, k := range keys {
+		c, ok := t.counters[k]
+		if !ok {
+			// Cleared while the attempt was in flight
+			if !failed {
+				continue
+			}
+			c = &counter{}
+			t.counters[k] = c
+		}
+		if c.pending > 0 {
+			c.pending--
+		}
+		if !failed {
+			continue
+		}
+
+		c.failures++
+		c.lastFailure = now
+		if lockAfter := t.thresholds(k.kind).LockAfter; lockAfter > 0 && c.failures >= lockAfter {
+			c.lockouts++
+			c.failures = 0
+			c.lockedUntil = now.Add(t.lockoutDuration(c.lockouts))
+		}
+	}
+}
+
+// Succeeded records a successful login, which clears the failures of the
+// username. Those of the IP are kept, so that a single valid account does not
+// let an attacker reset them.
+func (t *Tracker) Succeeded(attempt Attempt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	k := usernameKey(attempt)
+	if c, ok := t.counters[k]; ok && c.pending > 0 {
+		// Keep the count of other attempts still in flight
+		*c = counter{pending: c.pending}
+		return
+	}
+	delete(t.counters, k)
+}
+
+// List returns the usernames and IPs currently locked, the longest locked first
+func (t *Tracker) List() []Lockout {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	lockouts := []Lockout{}
+	for k, c := range t.counters {
+		if !c.lockedUntil.After(now) {
+			continue
+		}
+		lockouts = append(lockouts, Lockout{
+			Kind:        k.kind,
+			Tenant:      k.tenant,
+			Subject:     k.subject,
+			LockedUntil: c.lockedUntil,
+			Lockouts:    c.lockouts,
+		})
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].LockedUntil.After(lockouts[j].LockedUntil)
+	})
+	return lockouts
+}
+
+// Clear forgets the failures and lockouts of a username in tenant, or of an
+// IP, and reports whether there were any
+func (t *Tracker) Clear(kind Kind, tenant, subject string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	k := key{kind: kind, subject: subject}
+	if kind == KindUsername {
+		k = usernameKey(Attempt{Tenant: tenant, Username: subject})
+	}
+
+	_, ok := t.counters[k]
+	delete(t.counters, k)
+	return ok
+}
+
+// keys returns the counters an attempt is checked against
+func (t *Tracker) keys(attempt Attempt) []key {
+	return []key{usernameKey(attempt), {kind: KindIP, subject: attempt.IP}}
+}
+
+// counter returns the live counter under k, or nil
+func (t *Tracker) counter(k key, now time.Time) *counter {
+	c, ok := t.counters[k]
+	if !ok || t.expired(c, now) {
+		return nil
+	}
+	return c
+}
+
+// expired reports whether a counter has been quiet for a whole window, with
+// no attempts in flight
+func (t *Tracker) expired(c *counter, now time.Time) bool {
+	if c.pending > 0 {
+		return false
+	}
+	last := c.lastFailure
+	if c.lockedUntil.After(last) {
+		last = c.lockedUntil
+	}
+	return !now.Before(last.Add(t.cfg.Window))
+}
+
+// thresholds returns the thresholds for a kind of counter
+func (t *Tracker) thresholds(kind Kind) config.LoginThresholds {
+	if kind == KindIP {
+		return t.cfg.IP
+	}
+	return t.cfg.Username
+}
+
+// delay returns the delay after the given number of failures, doubling with
+// every failure past the threshold
+func (t *Tracker) delay(kind Kind, failures int) time.Duration {
+	delayAfter := t.thresholds(kind).DelayAfter
+	if delayAfter <= 0 || failures < delayAfter {
+		return 0
+	}
+	return doubled(t.cfg.Delay, failures-delayAfter, t.cfg.MaxDelay)
+}
+
+// lockoutDuration returns the length of the nth lockout in a row
+func (t *Tracker) lockoutDuration(n int) time.Duration {
+	return doubled(t.cfg.LockoutDuration, n-1, t.cfg.MaxLockoutDuration)
+}
+
+// sweep evicts expired counters
+func (t *Tracker) sweep(now time.Time) {
+	for k, c := range t.counters {
+		if t.expired(c, now) {
+			delete(t.counters, k)
+		}
+	}
+	t.lastSweep = now
+}
+
+// usernameKey returns the counter key of the attempted username. Usernames
+// are compared case-insensitively, as most providers do.
+func usernameKey(attempt Attempt) key {
+	return key{
+		kind:    KindUsername,
+		tenant:  attempt.Tenant,
+		subject: strings.ToLower(strings.TrimSpace(attempt.Username)),
+	}
+}
+
+// doubled returns base doubled n times, capped at max
+func doubled(base time.Duration, n int, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
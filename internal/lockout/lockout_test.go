@@ -0,0 +1,186 @@
+package lockout
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+func newTestTracker() (*Tracker, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	tracker := NewTracker(config.LoginProtectionConfig{
+		Enabled:            true,
+		Window:             15 * time.Minute,
+		Delay:              time.Second,
+		MaxDelay:           4 * time.Second,
+		LockoutDuration:    time.Minute,
+		MaxLockoutDuration: time.Hour,
+		Username:           config.LoginThresholds{DelayAfter: 2, LockAfter: 5},
+		IP:                 config.LoginThresholds{DelayAfter: 10, LockAfter: 20},
+	})
+	tracker.now = func() time.Time { return now }
+	tracker.lastSweep = now
+	return tracker, &now
+}
+
+// fail records a failed attempt
+func fail(t *testing.T, tracker *Tracker, attempt Attempt) {
+	t.Helper()
+
+	decision, done := tracker.Begin(attempt)
+	if decision.Locked() {
+		t.Fatalf("attempt %+v was locked", attempt)
+	}
+	done(true)
+}
+
+func TestTrackerDelaysThenLocks(t *testing.T) {
+	tracker, now := newTestTracker()
+	attempt := Attempt{Username: "Alice", IP: "192.0.2.1"}
+
+	wantDelays := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second}
+	for i, want := range wantDelays {
+		decision := tracker.Check(attempt)
+		if decision.Locked() {
+			t.Fatalf("attempt %d was locked before the threshold", i+1)
+		}
+		if decision.Delay != want {
+			t.Errorf("attempt %d was delayed %v, want %v", i+1, decision.Delay, want)
+		}
+		fail(t, tracker, attempt)
+	}
+
+	decision := tracker.Check(Attempt{Username: "alice", IP: "198.51.100.7"})
+	if decision.RetryAfter != time.Minute {
+		t.Fatalf("username lockout retries after %v, want 1m from any IP", decision.RetryAfter)
+	}
+	if lockouts := tracker.List(); len(lockouts) != 1 || lockouts[0].Subject != "alice" {
+		t.Errorf("List returned %+v, want the lockout of alice", lockouts)
+	}
+
+	// The next lockout in a row lasts twice as long
+	*now = now.Add(time.Minute)
+	for i := 0; i < 5; i++ {
+		fail(t, tracker, attempt)
+	}
+	if decision := tracker.Check(attempt); decision.RetryAfter != 2*time.Minute {
+		t.Errorf("second lockout retries after %v, want 2m", decision.RetryAfter)
+	}
+}
+
+func TestTrackerSuccessKeepsIPFailures(t *testing.T) {
+	tracker, _ := newTestTracker()
+
+	for i := 0; i < 19; i++ {
+		fail(t, tracker, Attempt{Username: "user" + string(rune('a'+i)), IP: "192.0.2.1"})
+	}
+	tracker.Succeeded(Attempt{Username: "attacker", IP: "192.0.2.1"})
+	fail(t, tracker, Attempt{Username: "victim", IP: "192.0.2.1"})
+
+	if !tracker.Check(Attempt{Username: "someone", IP: "192.0.2.1"}).Locked() {
+		t.Error("IP was not locked after failing across many usernames")
+	}
+	if !tracker.Clear(KindIP, "", "192.0.2.1") {
+		t.Error("Clear did not find the IP lockout")
+	}
+	if tracker.Check(Attempt{Username: "someone", IP: "192.0.2.1"}).Locked() {
+		t.Error("IP is still locked after Clear")
+	}
+}
+
+func TestTrackerForgetsAfterWindow(t *testing.T) {
+	tracker, now := newTestTracker()
+	attempt := Attempt{Tenant: "acme", Username: "alice", IP: "192.0.2.1"}
+
+	for i := 0; i < 4; i++ {
+		fail(t, tracker, attempt)
+	}
+	if tracker.Check(Attempt{Tenant: "other", Username: "alice", IP: "198.51.100.7"}).Delay != 0 {
+		t.Error("failures in one tenant delayed the same username in another")
+	}
+
+	*now = now.Add(15 * time.Minute)
+	fail(t, tracker, Attempt{Username: "bob", IP: "198.51.100.7"})
+	if n := len(tracker.counters); n != 2 {
+		t.Errorf("tracker holds %d counters after the window, want only the 2 of the new failure", n)
+	}
+}
+
+func TestTrackerCapsAttemptsInFlight(t *testing.T) {
+	tracker, _ := newTestTracker()
+	tracker.cfg.Username.MaxInFlight = 3
+	attempt := Attempt{Username: "alice", IP: "192.0.2.1"}
+
+	// Begin every attempt before any fails, as parallel requests would
+	const attempts = 50
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		admitted []func(failed bool)
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			decision, done := tracker.Begin(attempt)
+			if decision.Locked() || decision.Busy {
+				return
+			}
+			mu.Lock()
+			admitted = append(admitted, done)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(admitted) != 3 {
+		t.Fatalf("%d parallel attempts were admitted, want the 3 of the in-flight limit", len(admitted))
+	}
+	if decision := tracker.Check(attempt); !decision.Busy || decision.Locked() {
+		t.Errorf("decision with 3 attempts in flight is %+v, want busy but not locked", decision)
+	}
+
+	admitted[0](true)
+	if decision := tracker.Check(attempt); decision.Busy {
+		t.Error("attempts are still refused after one completed")
+	}
+}
+
+func TestTrackerDoesNotCountAttemptsInFlightAsFailures(t *testing.T) {
+	tracker, _ := newTestTracker()
+	attempt := Attempt{Username: "alice", IP: "192.0.2.1"}
+
+	// As many attempts as the username lock threshold, all in flight at once
+	var pending []func(failed bool)
+	for i := 0; i < 5; i++ {
+		decision, done := tracker.Begin(attempt)
+		if decision.Locked() || decision.Delay != 0 {
+			t.Fatalf("attempt %d with no failures recorded got decision %+v, want none", i+1, decision)
+		}
+		pending = append(pending, done)
+	}
+
+	for _, done := range pending {
+		done(true)
+	}
+	if decision := tracker.Check(attempt); decision.RetryAfter != time.Minute {
+		t.Errorf("username retries after %v once the attempts failed, want 1m", decision.RetryAfter)
+	}
+}
+
+func TestTrackerReleasesSucceededAttempts(t *testing.T) {
+	tracker, _ := newTestTracker()
+	attempt := Attempt{Username: "alice", IP: "192.0.2.1"}
+
+	for i := 0; i < 5; i++ {
+		_, done := tracker.Begin(attempt)
+		tracker.Succeeded(attempt)
+		done(false)
+	}
+	if decision := tracker.Check(attempt); decision.Locked() || decision.Delay != 0 {
+		t.Errorf("successful attempts left decision %+v, want none", decision)
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
+)
+
+const (
+	// tokenInfoKey is the context key under which the caller's TokenInfo is stored
+	tokenInfoKey = "token_info"
+)
+
+// ErrForbidden is returned when an authenticated caller lacks the required roles
+var ErrForbidden = errors.New("forbidden")
+
+// AuthMiddleware validates the bearer token through the IAM provider and
+// stores the resulting TokenInfo in the context
+func AuthMiddleware(iamProvider provider.IAMProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := BearerToken(c)
+		if token == "" {
+			c.Error(provider.ErrTokenInvalid)
+			c.Abort()
+			return
+		}
+
+		tokenInfo, err := iamProvider.ValidateToken(c.Request.Context(), token)
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		c.Set(tokenInfoKey, tokenInfo)
+		if tokenInfo.UserID != "" {
+			withLogFields(c, logger.String("user", tokenInfo.UserID))
+		}
+
+		c.Next()
+	}
+}
+
+// AuthorizationMiddleware enforces the role requirements configured for the
+// matched route. It must run after AuthMiddleware.
+func AuthorizationMiddleware(cfg *config.AuthorizationConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenInfo, ok := GetTokenInfo(c)
+		if !ok {
+			c.Error(provider.ErrTokenInvalid)
+			c.Abort()
+			return
+		}
+
+		roles := cfg.DefaultRoles
+		allowSelf := false
+		if rule := cfg.RuleFor(c.Request.Method, routePath(c)); rule != nil {
+			roles = rule.Roles
+			allowSelf = rule.AllowSelf
+		}
+
+		if allowSelf && tokenInfo.UserID != "" && c.Param("id") == tokenInfo.UserID {
+			c.Next()
+			return
+		}
+
+		if len(roles) > 0 && !HasAnyRole(tokenInfo, cfg.RoleClients, roles...) {
+			c.Error(ErrForbidden)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// GetTokenInfo retrieves the authenticated caller's token information from the context
+func GetTokenInfo(c *gin.Context) (*provider.TokenInfo, bool) {
+	if value, exists := c.Get(tokenInfoKey); exists {
+		if tokenInfo, ok := value.(*provider.TokenInfo); ok {
+			return tokenInfo, true
+		}
+	}
+	return nil, false
+}
+
+// HasAnyRole reports whether the token carries at least one of the given roles.
+// A role of the form "client:role" also matches the client role "role" of
+// "client" when client is one of roleClients, so "users:admin" is satisfied by
+// either a realm role with that name or, with "users" trusted, the "admin"
+// role of the "users" client.
+func HasAnyRole(tokenInfo *provider.TokenInfo, roleClients []string, roles ...string) bool {
+	for _, required := range roles {
+		for _, role := range tokenInfo.Roles {
+			if role == required {
+				return true
+			}
+		}
+
+		client, role, found := strings.Cut(required, ":")
+		if !found || !slices.Contains(roleClients, client) {
+			continue
+		}
+		for _, clientRole := range tokenInfo.ClientRoles[client] {
+			if clientRole == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BearerToken extracts the token from the Authorization header
+func BearerToken(c *gin.Context) string {
+	token := c.GetHeader("Authorization")
+	if token == "" {
+		return ""
+	}
+
+	// Remove "Bearer " prefix if present
+	if len(token) > 7 && strings.EqualFold(token[:7], "Bearer ") {
+		return token[7:]
+	}
+
+	return token
+}
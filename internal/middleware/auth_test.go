@@ -0,0 +1,124 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/middleware"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+)
+
+// tokenProvider is an IAM provider that only validates the tokens it knows
+type tokenProvider struct {
+	provider.IAMProvider
+	tokens map[string]*provider.TokenInfo
+}
+
+func (p *tokenProvider) ValidateToken(ctx context.Context, token string) (*provider.TokenInfo, error) {
+	if info, ok := p.tokens[token]; ok {
+		return info, nil
+	}
+	return nil, provider.ErrTokenInvalid
+}
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AuthorizationConfig{
+		DefaultRoles: []string{"users:admin"},
+		RoleClients:  []string{"users"},
+		Rules: []config.AuthorizationRule{
+			{Method: http.MethodGet, Path: "/users/:id", Roles: []string{"users:admin", "users:read"}, AllowSelf: true},
+			{Method: http.MethodPut, Path: "/users/:id", Roles: []string{"users:admin"}},
+			{Method: http.MethodGet, Path: "/open", Roles: []string{}},
+		},
+	}
+	iamProvider := &tokenProvider{tokens: map[string]*provider.TokenInfo{
+		"admin":       {UserID: "1", Roles: []string{"users:admin"}},
+		"reader":      {UserID: "2", Roles: []string{"users:read"}},
+		"nobody":      {UserID: "3"},
+		"client":      {UserID: "4", ClientRoles: map[string][]string{"users": {"admin"}}},
+		"otherClient": {UserID: "5", ClientRoles: map[string][]string{"billing": {"admin"}}},
+	}}
+
+	router := gin.New()
+	router.Use(middleware.ErrorHandlerMiddleware())
+	authorized := router.Group("/",
+		middleware.AuthMiddleware(iamProvider), middleware.AuthorizationMiddleware(cfg))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	authorized.GET("/users/:id", ok)
+	authorized.PUT("/users/:id", ok)
+	authorized.GET("/open", ok)
+	authorized.GET("/unruled", ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "rule role", method: http.MethodGet, path: "/users/9", token: "reader", want: http.StatusOK},
+		{name: "rule role missing", method: http.MethodPut, path: "/users/9", token: "reader", want: http.StatusForbidden},
+		{name: "allow self", method: http.MethodGet, path: "/users/3", token: "nobody", want: http.StatusOK},
+		{name: "allow self other user", method: http.MethodGet, path: "/users/9", token: "nobody", want: http.StatusForbidden},
+		{name: "self without allow self", method: http.MethodPut, path: "/users/2", token: "reader", want: http.StatusForbidden},
+		{name: "empty rule roles", method: http.MethodGet, path: "/open", token: "nobody", want: http.StatusOK},
+		{name: "default roles", method: http.MethodGet, path: "/unruled", token: "admin", want: http.StatusOK},
+		{name: "default roles missing", method: http.MethodGet, path: "/unruled", token: "reader", want: http.StatusForbidden},
+		{name: "trusted client role", method: http.MethodPut, path: "/users/9", token: "client", want: http.StatusOK},
+		{name: "untrusted client role", method: http.MethodPut, path: "/users/9", token: "otherClient", want: http.StatusForbidden},
+		{name: "invalid token", method: http.MethodGet, path: "/open", token: "unknown", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("%s %s returned %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasAnyRole(t *testing.T) {
+	tokenInfo := &provider.TokenInfo{
+		Roles: []string{"users:read", "auditor"},
+		ClientRoles: map[string][]string{
+			"users":   {"admin"},
+			"billing": {"admin"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		roleClients []string
+		roles       []string
+		want        bool
+	}{
+		{name: "realm role", roles: []string{"users:admin", "users:read"}, want: true},
+		{name: "plain realm role", roles: []string{"auditor"}, want: true},
+		{name: "no role", roles: []string{"users:admin"}, want: false},
+		{name: "no roles required", want: false},
+		{name: "client role of trusted client", roleClients: []string{"users"}, roles: []string{"users:admin"}, want: true},
+		{name: "client role of untrusted client", roleClients: []string{"users"}, roles: []string{"billing:admin"}, want: false},
+		{name: "client role without trusted clients", roles: []string{"users:admin"}, want: false},
+		{name: "plain role does not match client roles", roleClients: []string{"users"}, roles: []string{"admin"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := middleware.HasAnyRole(tokenInfo, tt.roleClients, tt.roles...); got != tt.want {
+				t.Errorf("HasAnyRole(%v) = %v, want %v", tt.roles, got, tt.want)
+			}
+		})
+	}
+}
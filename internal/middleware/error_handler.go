@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"errors"
+	"github.com/zahidhasanpapon/iam-bridge/internal/lockout"
 	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
 	"net/http"
 
@@ -13,6 +14,7 @@ type APIError struct {
 	Code      string `json:"code"`
 	Message   string `json:"message"`
 	RequestID string `json:"request_id,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
 }
 
 // ErrorHandlerMiddleware handles errors in a standardized way
@@ -31,6 +33,7 @@ func ErrorHandlerMiddleware() gin.HandlerFunc {
 // handleError processes different types of errors and returns appropriate responses
 func handleError(c *gin.Context, err error) {
 	requestID := GetRequestID(c)
+	tenantID := GetTenant(c)
 
 	// Map common errors to HTTP status codes and error codes
 	switch {
@@ -39,6 +42,7 @@ func handleError(c *gin.Context, err error) {
 			Code:      "INVALID_CREDENTIALS",
 			Message:   "Invalid username or password",
 			RequestID: requestID,
+			Tenant:    tenantID,
 		})
 
 	case errors.Is(err, provider.ErrTokenExpired):
@@ -46,6 +50,7 @@ func handleError(c *gin.Context, err error) {
 			Code:      "TOKEN_EXPIRED",
 			Message:   "Authentication token has expired",
 			RequestID: requestID,
+			Tenant:    tenantID,
 		})
 
 	case errors.Is(err, provider.ErrTokenInvalid):
@@ -53,6 +58,15 @@ func handleError(c *gin.Context, err error) {
 			Code:      "INVALID_TOKEN",
 			Message:   "Invalid authentication token",
 			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, ErrForbidden):
+		c.JSON(http.StatusForbidden, APIError{
+			Code:      "FORBIDDEN",
+			Message:   "Insufficient permissions for this operation",
+			RequestID: requestID,
+			Tenant:    tenantID,
 		})
 
 	case errors.Is(err, provider.ErrUserNotFound):
@@ -60,6 +74,86 @@ func handleError(c *gin.Context, err error) {
 			Code:      "USER_NOT_FOUND",
 			Message:   "User not found",
 			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, provider.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, APIError{
+			Code:      "ROLE_NOT_FOUND",
+			Message:   "Role not found",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, provider.ErrUserConflict):
+		c.JSON(http.StatusConflict, APIError{
+			Code:      "USER_CONFLICT",
+			Message:   "User conflicts with an existing user",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, provider.ErrTenantRequired):
+		c.JSON(http.StatusBadRequest, APIError{
+			Code:      "TENANT_REQUIRED",
+			Message:   "The request does not identify a tenant",
+			RequestID: requestID,
+		})
+
+	case errors.Is(err, provider.ErrTenantNotFound):
+		c.JSON(http.StatusNotFound, APIError{
+			Code:      "TENANT_NOT_FOUND",
+			Message:   "Tenant not found",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, ErrRateLimited):
+		c.JSON(http.StatusTooManyRequests, APIError{
+			Code:      "RATE_LIMITED",
+			Message:   "Too many requests, retry later",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, lockout.ErrLocked):
+		c.JSON(http.StatusTooManyRequests, APIError{
+			Code:      "ACCOUNT_LOCKED",
+			Message:   "Too many failed login attempts, retry later",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, lockout.ErrBusy):
+		c.JSON(http.StatusTooManyRequests, APIError{
+			Code:      "LOGIN_BUSY",
+			Message:   "Too many logins in progress, retry later",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, lockout.ErrNotFound):
+		c.JSON(http.StatusNotFound, APIError{
+			Code:      "LOCKOUT_NOT_FOUND",
+			Message:   "No failed logins are recorded for the username or IP",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, ErrRateLimitUnavailable):
+		c.JSON(http.StatusServiceUnavailable, APIError{
+			Code:      "RATE_LIMIT_UNAVAILABLE",
+			Message:   "Rate limiting is unavailable, retry later",
+			RequestID: requestID,
+			Tenant:    tenantID,
+		})
+
+	case errors.Is(err, provider.ErrUnsupportedOperation):
+		c.JSON(http.StatusNotImplemented, APIError{
+			Code:      "UNSUPPORTED_OPERATION",
+			Message:   "Operation is not supported by the configured IAM provider",
+			RequestID: requestID,
+			Tenant:    tenantID,
 		})
 
 	default:
@@ -68,6 +162,7 @@ func handleError(c *gin.Context, err error) {
 			Code:      "INTERNAL_SERVER_ERROR",
 			Message:   "An unexpected error occurred",
 			RequestID: requestID,
+			Tenant:    tenantID,
 		})
 	}
 }
@@ -2,35 +2,130 @@ package middleware
 
 import (
 	"bytes"
-	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
 	"io"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/redact"
+	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
+)
+
+// Capture policies of the request log
+const (
+	captureOff      = "off"
+	captureMetadata = "metadata"
+	captureRedacted = "redacted"
+	captureFull     = "full"
 )
 
-// responseWriter captures the status code and response size
+// defaultMaxBodySize is how many bytes of a body are captured when no limit
+// is configured
+const defaultMaxBodySize = 1024
+
+// capturePolicy is the capture policy applied to the routes below path
+type capturePolicy struct {
+	method string
+	path   string
+	mode   string
+}
+
+// bodyCapture records the first bytes of a request body as the handler reads
+// it, so the body is neither read ahead nor held in memory as a whole
+type bodyCapture struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	limit int
+	size  int64
+	eof   bool
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	b.size += int64(n)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// complete reports whether the whole body was read and captured
+func (b *bodyCapture) complete(contentLength int64) bool {
+	if b.size > int64(b.limit) {
+		return false
+	}
+	return b.eof || b.size == contentLength
+}
+
+// responseWriter captures the first bytes of the response body
 type responseWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	body  *bytes.Buffer
+	limit int
 }
 
 func (w *responseWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+	w.capture(b)
 	return w.ResponseWriter.Write(b)
 }
 
-// LoggerMiddleware returns a middleware for logging HTTP requests
-func LoggerMiddleware(log logger.Logger) gin.HandlerFunc {
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// capture keeps b while the captured body is within the limit
+func (w *responseWriter) capture(b []byte) {
+	if room := w.limit - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(len(b), room)])
+	}
+}
+
+// LoggerMiddleware returns a middleware for logging HTTP requests. What is
+// captured of request and response headers and bodies depends on the capture
+// policy of the route in cfg; redactor masks sensitive values under the
+// redacted policy. Bodies larger than the capture limit are not logged.
+func LoggerMiddleware(log logger.Logger, cfg *config.CaptureConfig, redactor *redact.Redactor) gin.HandlerFunc {
+	maxBodySize := cfg.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+
+	defaultMode := strings.ToLower(cfg.Mode)
+	if defaultMode == "" {
+		defaultMode = captureRedacted
+	}
+	policies := make([]capturePolicy, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		policies[i] = capturePolicy{
+			method: route.Method,
+			path:   strings.TrimSuffix(route.Path, "/"),
+			mode:   strings.ToLower(route.Mode),
+		}
+	}
+
 	return func(c *gin.Context) {
 		// Start timer
 		start := time.Now()
 
-		// Create a copy of the request body for logging
-		var requestBody []byte
-		if c.Request.Body != nil {
-			requestBody, _ = io.ReadAll(c.Request.Body)
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		// Scope the request logger to the request ID; tenant and user are
+		// added once known
+		c.Request = c.Request.WithContext(logger.NewContext(c.Request.Context(),
+			log.With(logger.String("request_id", GetRequestID(c)))))
+
+		mode := matchCaptureMode(policies, defaultMode, c.Request.Method, routePath(c))
+		captureBodies := mode == captureRedacted || mode == captureFull
+
+		// Capture the request body as the handler reads it
+		var requestBody *bodyCapture
+		if captureBodies && c.Request.Body != nil && c.Request.Body != http.NoBody {
+			requestBody = &bodyCapture{ReadCloser: c.Request.Body, limit: maxBodySize}
+			c.Request.Body = requestBody
 		}
 
 		// Create a custom response writer
@@ -38,6 +133,9 @@ func LoggerMiddleware(log logger.Logger) gin.HandlerFunc {
 			ResponseWriter: c.Writer,
 			body:           &bytes.Buffer{},
 		}
+		if captureBodies {
+			w.limit = maxBodySize
+		}
 		c.Writer = w
 
 		// Process request
@@ -47,39 +145,108 @@ func LoggerMiddleware(log logger.Logger) gin.HandlerFunc {
 		duration := time.Since(start)
 
 		// Log request details
-		fields := map[string]interface{}{
-			"client_ip":     c.ClientIP(),
-			"method":        c.Request.Method,
-			"path":          c.Request.URL.Path,
-			"status":        c.Writer.Status(),
-			"duration":      duration.String(),
-			"duration_ms":   duration.Milliseconds(),
-			"user_agent":    c.Request.UserAgent(),
-			"error":         c.Errors.String(),
-			"response_size": c.Writer.Size(),
+		fields := []logger.Field{
+			logger.String("client_ip", c.ClientIP()),
+			logger.String("method", c.Request.Method),
+			logger.String("path", c.Request.URL.Path),
+			logger.Int("status", c.Writer.Status()),
+			logger.Duration("duration", duration),
+			logger.Int64("duration_ms", duration.Milliseconds()),
+			logger.String("user_agent", c.Request.UserAgent()),
+			logger.Int("response_size", c.Writer.Size()),
 		}
 
-		// Add request body if present and not too large
-		if len(requestBody) > 0 && len(requestBody) < 1024 {
-			fields["request_body"] = string(requestBody)
+		if len(c.Errors) > 0 {
+			fields = append(fields, logger.String("error", c.Errors.String()))
 		}
 
-		// Add response body if present and not too large
-		if w.body.Len() > 0 && w.body.Len() < 1024 {
-			fields["response_body"] = w.body.String()
+		if mode != captureOff {
+			requestType := c.Request.Header.Get("Content-Type")
+			responseType := c.Writer.Header().Get("Content-Type")
+
+			if requestType != "" {
+				fields = append(fields, logger.String("request_content_type", requestType))
+			}
+			if responseType != "" {
+				fields = append(fields, logger.String("response_content_type", responseType))
+			}
+			if c.Request.ContentLength > 0 {
+				fields = append(fields, logger.Int64("request_size", c.Request.ContentLength))
+			} else if requestBody != nil && requestBody.size > 0 {
+				fields = append(fields, logger.Int64("request_size", requestBody.size))
+			}
+
+			if captureBodies {
+				fields = append(fields, logger.Any("request_headers", captureHeaders(mode, c.Request.Header, redactor)))
+
+				// Add request body if fully captured
+				if requestBody != nil && requestBody.size > 0 && requestBody.complete(c.Request.ContentLength) {
+					if body, ok := captureBody(mode, requestType, requestBody.buf.Bytes(), redactor); ok {
+						fields = append(fields, logger.String("request_body", body))
+					}
+				}
+
+				// Add response body if fully captured
+				if size := c.Writer.Size(); size > 0 && size <= maxBodySize {
+					if body, ok := captureBody(mode, responseType, w.body.Bytes(), redactor); ok {
+						fields = append(fields, logger.String("response_body", body))
+					}
+				}
+			}
 		}
 
-		// Log based on status code
+		// Log based on status code, with the request ID, tenant and user
+		// the request logger was scoped to
+		requestLog := logger.FromContext(c.Request.Context())
 		status := c.Writer.Status()
 		switch {
 		case status >= 500:
-			log.Error("Server error", fields)
+			requestLog.Error("Server error", fields...)
 		case status >= 400:
-			log.Info("Client error", fields)
+			requestLog.Info("Client error", fields...)
 		case status >= 300:
-			log.Info("Redirection", fields)
+			requestLog.Info("Redirection", fields...)
 		default:
-			log.Info("Success", fields)
+			requestLog.Info("Success", fields...)
 		}
 	}
 }
+
+// withLogFields adds fields to the request logger
+func withLogFields(c *gin.Context, fields ...logger.Field) {
+	ctx := c.Request.Context()
+	c.Request = c.Request.WithContext(logger.NewContext(ctx, logger.FromContext(ctx).With(fields...)))
+}
+
+// matchCaptureMode returns the capture mode of the policy that matches the
+// route best, or fallback
+func matchCaptureMode(policies []capturePolicy, fallback, method, route string) string {
+	mode, bestScore := fallback, -1
+	for _, policy := range policies {
+		if score := routeMatchScore(policy.method, policy.path, method, route); score > bestScore {
+			mode, bestScore = policy.mode, score
+		}
+	}
+	return mode
+}
+
+// captureHeaders returns the headers to log for mode
+func captureHeaders(mode string, header http.Header, redactor *redact.Redactor) map[string]string {
+	if mode == captureFull {
+		captured := make(map[string]string, len(header))
+		for name, values := range header {
+			captured[name] = strings.Join(values, ", ")
+		}
+		return captured
+	}
+	return redactor.Headers(header)
+}
+
+// captureBody returns the body to log for mode. ok is false when the body
+// cannot be redacted safely and must not be logged.
+func captureBody(mode, contentType string, body []byte, redactor *redact.Redactor) (string, bool) {
+	if mode == captureFull {
+		return string(body), true
+	}
+	return redactor.Body(contentType, body)
+}
@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/middleware"
+	"github.com/zahidhasanpapon/iam-bridge/internal/redact"
+	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggerMiddlewareBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		body   string
+		logged bool
+	}{
+		{name: "within limit", body: `{"note":"hello"}`, logged: true},
+		{name: "oversized", body: `{"note":"` + strings.Repeat("x", 64) + `"}`, logged: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			redactor, err := redact.New(config.RedactConfig{})
+			if err != nil {
+				t.Fatalf("failed to create redactor: %v", err)
+			}
+
+			router := gin.New()
+			router.Use(middleware.LoggerMiddleware(logger.FromZap(zap.New(core)),
+				&config.CaptureConfig{Mode: "redacted", MaxBodySize: 32}, redactor))
+			// The handler streams the request body back as the response
+			router.POST("/echo", func(c *gin.Context) {
+				c.Header("Content-Type", "application/json")
+				c.Status(http.StatusOK)
+				if _, err := io.Copy(c.Writer, c.Request.Body); err != nil {
+					t.Errorf("failed to stream body: %v", err)
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Body.String() != tt.body {
+				t.Errorf("handler streamed %q, want %q", rec.Body.String(), tt.body)
+			}
+
+			entries := logs.All()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(entries))
+			}
+			fields := entries[0].ContextMap()
+
+			if fields["request_size"] != int64(len(tt.body)) {
+				t.Errorf("request_size is %v, want %d", fields["request_size"], len(tt.body))
+			}
+			for _, key := range []string{"request_body", "response_body"} {
+				body, ok := fields[key]
+				if ok != tt.logged {
+					t.Errorf("%s logged: %v, want %v", key, ok, tt.logged)
+				}
+				if tt.logged && body != tt.body {
+					t.Errorf("%s is %v, want %q", key, body, tt.body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/ratelimit"
+	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
+)
+
+var (
+	// ErrRateLimited is returned when a client has used up its rate limit
+	ErrRateLimited = errors.New("rate limited")
+	// ErrRateLimitUnavailable is returned when the rate limit store cannot be
+	// reached and the failure mode is closed
+	ErrRateLimitUnavailable = errors.New("rate limit unavailable")
+)
+
+// rateLimitPolicy is the limit applied to the routes below path
+type rateLimitPolicy struct {
+	// name prefixes the bucket keys of the policy, so every override has
+	// buckets of its own
+	name   string
+	method string
+	path   string
+	key    string
+	limit  ratelimit.Limit
+}
+
+// RateLimitMiddleware limits requests with a token bucket per client, using
+// the most specific route override in cfg. Placed after AuthMiddleware,
+// clients can be keyed by subject or OAuth client instead of IP. While store
+// is unreachable, requests are let through or rejected by the failure mode.
+func RateLimitMiddleware(cfg *config.RateLimitConfig, store ratelimit.Store) gin.HandlerFunc {
+	failClosed := strings.EqualFold(cfg.Store.FailureMode, "closed")
+
+	defaultPolicy := newRateLimitPolicy("default", "", "", cfg.Key, cfg.RequestsPerSecond, cfg.Burst)
+	policies := make([]rateLimitPolicy, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		key := route.Key
+		if key == "" {
+			key = cfg.Key
+		}
+		name := strings.ToUpper(route.Method) + " " + route.Path
+		policies[i] = newRateLimitPolicy(name, route.Method, route.Path, key, route.RequestsPerSecond, route.Burst)
+	}
+
+	return func(c *gin.Context) {
+		policy := matchRateLimitPolicy(policies, defaultPolicy, c.Request.Method, routePath(c))
+		if allowRequest(c, store, policy.name+"|"+rateLimitKey(c, policy.key), policy.limit, failClosed) {
+			c.Next()
+		}
+	}
+}
+
+// PreAuthRateLimitMiddleware limits requests per IP ahead of AuthMiddleware,
+// so that requests with invalid tokens are limited before they reach the IAM
+// provider. Its buckets are apart from those of RateLimitMiddleware, which
+// can then key the authenticated requests by subject or client.
+func PreAuthRateLimitMiddleware(cfg *config.RateLimitConfig, store ratelimit.Store) gin.HandlerFunc {
+	failClosed := strings.EqualFold(cfg.Store.FailureMode, "closed")
+
+	rate, burst := cfg.PreAuth.RequestsPerSecond, cfg.PreAuth.Burst
+	if rate <= 0 {
+		rate, burst = cfg.RequestsPerSecond, cfg.Burst
+	}
+	policy := newRateLimitPolicy("pre-auth", "", "", "ip", rate, burst)
+
+	return func(c *gin.Context) {
+		if allowRequest(c, store, policy.name+"|ip:"+c.ClientIP(), policy.limit, failClosed) {
+			c.Next()
+		}
+	}
+}
+
+// allowRequest takes a token from the bucket under key and sets the rate limit
+// headers. When the request is limited, or the store failed and failClosed is
+// set, it records the error, aborts the request and returns false.
+func allowRequest(c *gin.Context, store ratelimit.Store, key string, limit ratelimit.Limit, failClosed bool) bool {
+	result, err := store.Allow(c.Request.Context(), key, limit)
+	if err != nil {
+		if !failClosed {
+			logger.FromContext(c.Request.Context()).Error("Rate limit store failed, letting request through", logger.Err(err))
+			return true
+		}
+
+		c.Error(fmt.Errorf("%w: %v", ErrRateLimitUnavailable, err))
+		c.Abort()
+		return false
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", ceilSeconds(result.Reset))
+
+	if !result.Allowed {
+		SetRetryAfter(c, result.RetryAfter)
+		c.Error(ErrRateLimited)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// newRateLimitPolicy creates a policy, defaulting the burst to the rate
+// rounded up
+func newRateLimitPolicy(name, method, path, key string, rate float64, burst int) rateLimitPolicy {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	return rateLimitPolicy{
+		name:   name,
+		method: method,
+		path:   strings.TrimSuffix(path, "/"),
+		key:    strings.ToLower(key),
+		limit:  ratelimit.Limit{Rate: rate, Burst: burst},
+	}
+}
+
+// matchRateLimitPolicy returns the policy that matches the route best
+func matchRateLimitPolicy(policies []rateLimitPolicy, fallback rateLimitPolicy, method, route string) rateLimitPolicy {
+	best, bestScore := fallback, -1
+	for _, policy := range policies {
+		if score := routeMatchScore(policy.method, policy.path, method, route); score > bestScore {
+			best, bestScore = policy, score
+		}
+	}
+	return best
+}
+
+// routeMatchScore scores how specifically an override for method and path
+// covers a request, or returns -1 when it does not. The longest path wins,
+// and an override for the method beats one for any method on the same path.
+func routeMatchScore(method, path, requestMethod, route string) int {
+	if method != "" && !strings.EqualFold(method, requestMethod) {
+		return -1
+	}
+	if route != path && !strings.HasPrefix(route, path+"/") {
+		return -1
+	}
+
+	score := 2 * len(path)
+	if method != "" {
+		score++
+	}
+	return score
+}
+
+// rateLimitKey identifies the client of the request for the given key kind,
+// falling back to its IP when the request is not authenticated
+func rateLimitKey(c *gin.Context, kind string) string {
+	if tokenInfo, ok := GetTokenInfo(c); ok {
+		switch kind {
+		case "subject":
+			if tokenInfo.UserID != "" {
+				return "subject:" + tokenInfo.UserID
+			}
+		case "client":
+			for _, claim := range []string{"azp", "client_id"} {
+				if client, _ := tokenInfo.Claims[claim].(string); client != "" {
+					return "client:" + client
+				}
+			}
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// SetRetryAfter tells the client to retry after d, rounded up to whole seconds
+func SetRetryAfter(c *gin.Context, d time.Duration) {
+	c.Header("Retry-After", ceilSeconds(d))
+}
+
+// ceilSeconds formats d as whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,154 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/middleware"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// A token every 100 seconds, so buckets do not refill during the test
+	cfg := &config.RateLimitConfig{
+		RequestsPerSecond: 0.01,
+		Burst:             3,
+		Routes: []config.RateLimitRoute{
+			{Path: "/api", RequestsPerSecond: 0.01, Burst: 2},
+			{Path: "/api/login", Method: http.MethodPost, RequestsPerSecond: 0.01, Burst: 1},
+		},
+	}
+	store := ratelimit.NewMemoryStore()
+	t.Cleanup(func() { _ = store.Close() })
+
+	router := gin.New()
+	router.Use(middleware.ErrorHandlerMiddleware(), middleware.RateLimitMiddleware(cfg, store))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/api/login", ok)
+	router.GET("/api/login", ok)
+	router.GET("/other", ok)
+
+	// Steps run in order against the same buckets
+	steps := []struct {
+		method     string
+		path       string
+		status     int
+		limit      string
+		remaining  string
+		retryAfter string
+	}{
+		// The method override beats the group and only allows one request
+		{http.MethodPost, "/api/login", http.StatusOK, "1", "0", ""},
+		{http.MethodPost, "/api/login", http.StatusTooManyRequests, "1", "0", "100"},
+		// Other methods fall back to the group, with buckets of its own
+		{http.MethodGet, "/api/login", http.StatusOK, "2", "1", ""},
+		{http.MethodGet, "/api/login", http.StatusOK, "2", "0", ""},
+		{http.MethodGet, "/api/login", http.StatusTooManyRequests, "2", "0", "100"},
+		// Routes without an override use the default limit
+		{http.MethodGet, "/other", http.StatusOK, "3", "2", ""},
+	}
+
+	for i, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != step.status {
+			t.Fatalf("step %d: %s %s returned %d, want %d", i, step.method, step.path, rec.Code, step.status)
+		}
+		if got := rec.Header().Get("RateLimit-Limit"); got != step.limit {
+			t.Errorf("step %d: RateLimit-Limit is %q, want %q", i, got, step.limit)
+		}
+		if got := rec.Header().Get("RateLimit-Remaining"); got != step.remaining {
+			t.Errorf("step %d: RateLimit-Remaining is %q, want %q", i, got, step.remaining)
+		}
+		if rec.Header().Get("RateLimit-Reset") == "" {
+			t.Errorf("step %d: RateLimit-Reset is missing", i)
+		}
+		if got := rec.Header().Get("Retry-After"); got != step.retryAfter {
+			t.Errorf("step %d: Retry-After is %q, want %q", i, got, step.retryAfter)
+		}
+
+		if step.status == http.StatusTooManyRequests {
+			var body middleware.APIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("step %d: failed to decode error: %v", i, err)
+			}
+			if body.Code != "RATE_LIMITED" {
+				t.Errorf("step %d: error code is %q, want RATE_LIMITED", i, body.Code)
+			}
+		}
+	}
+
+	// Another client has buckets of its own
+	req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	req.RemoteAddr = "192.0.2.2:1234"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("another client got %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestPreAuthRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.RateLimitConfig{
+		RequestsPerSecond: 0.01,
+		Burst:             5,
+		PreAuth:           config.RateLimitPreAuthConfig{RequestsPerSecond: 0.01, Burst: 2},
+	}
+	store := ratelimit.NewMemoryStore()
+	t.Cleanup(func() { _ = store.Close() })
+
+	validations := 0
+	iamProvider := &tokenProvider{tokens: map[string]*provider.TokenInfo{
+		"valid": {UserID: "1"},
+	}}
+	router := gin.New()
+	router.Use(middleware.ErrorHandlerMiddleware())
+	router.GET("/users",
+		middleware.PreAuthRateLimitMiddleware(cfg, store),
+		func(c *gin.Context) { validations++ },
+		middleware.AuthMiddleware(iamProvider),
+		middleware.RateLimitMiddleware(cfg, store),
+		func(c *gin.Context) { c.Status(http.StatusOK) },
+	)
+
+	request := func(ip, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Invalid tokens use up the IP's bucket before they are validated
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if rec := request("192.0.2.1", "garbage"); rec.Code != want {
+			t.Errorf("request %d with an invalid token returned %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	if validations != 2 {
+		t.Errorf("%d invalid tokens were validated, want the 2 of the pre-auth burst", validations)
+	}
+
+	// Authenticated requests are then limited by the keyed policy as well, in
+	// buckets of its own
+	rec := request("192.0.2.2", "valid")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request with a valid token returned %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("RateLimit-Limit"); got != "5" {
+		t.Errorf("RateLimit-Limit is %q, want the 5 of the keyed policy", got)
+	}
+}
@@ -9,8 +9,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// RecoveryMiddleware returns a middleware that recovers from panics
-func RecoveryMiddleware(log logger.Logger) gin.HandlerFunc {
+// RecoveryMiddleware returns a middleware that recovers from panics and logs
+// them to the request logger
+func RecoveryMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
@@ -18,13 +19,12 @@ func RecoveryMiddleware(log logger.Logger) gin.HandlerFunc {
 				stack := debug.Stack()
 
 				// Log the error with structured fields
-				log.Error(
+				logger.FromContext(c.Request.Context()).Error(
 					"Panic recovered",
-					"error", err,
-					"stack", string(stack),
-					"request_id", GetRequestID(c),
-					"path", c.Request.URL.Path,
-					"method", c.Request.Method,
+					logger.Any("panic", err),
+					logger.String("stack", string(stack)),
+					logger.String("path", c.Request.URL.Path),
+					logger.String("method", c.Request.Method),
 				)
 
 				// Return error response
@@ -41,7 +41,7 @@ func RecoveryMiddleware(log logger.Logger) gin.HandlerFunc {
 }
 
 // PanicHandler handles panic in a controlled way
-func PanicHandler(err interface{}, c *gin.Context, log logger.Logger) {
+func PanicHandler(err interface{}, c *gin.Context) {
 	var errMsg string
 	switch v := err.(type) {
 	case error:
@@ -53,11 +53,10 @@ func PanicHandler(err interface{}, c *gin.Context, log logger.Logger) {
 	}
 
 	// Log error with structured fields
-	log.Error(
+	logger.FromContext(c.Request.Context()).Error(
 		"Panic occurred",
-		"error", errMsg,
-		"stack", string(debug.Stack()),
-		"request_id", GetRequestID(c),
+		logger.String("panic", errMsg),
+		logger.String("stack", string(debug.Stack())),
 	)
 
 	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/tenant"
+	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
+)
+
+const (
+	// TenantHeader is the default header carrying the tenant ID in header mode
+	TenantHeader = "X-Tenant-ID"
+
+	// TenantPathPrefix is the route segment carrying the tenant ID in path mode
+	TenantPathPrefix = "/t/:tenant"
+)
+
+// TenantMiddleware resolves the tenant of the request according to cfg and
+// stores it in the request context, where providers, logs and errors pick it
+// up. Requests without a tenant are passed on unchanged; whether they can be
+// served is up to the provider.
+func TenantMiddleware(cfg *config.TenancyConfig) gin.HandlerFunc {
+	header := cfg.Header
+	if header == "" {
+		header = TenantHeader
+	}
+
+	return func(c *gin.Context) {
+		var id string
+		switch strings.ToLower(cfg.Mode) {
+		case "header":
+			id = c.GetHeader(header)
+		case "subdomain":
+			id = subdomainTenant(c.Request.Host, cfg.BaseDomain)
+		case "path":
+			id = c.Param("tenant")
+		}
+
+		if id = strings.ToLower(strings.TrimSpace(id)); id != "" {
+			c.Request = c.Request.WithContext(tenant.NewContext(c.Request.Context(), id))
+			withLogFields(c, logger.String("tenant", id))
+		}
+
+		c.Next()
+	}
+}
+
+// GetTenant retrieves the tenant of the request, or "" when there is none
+func GetTenant(c *gin.Context) string {
+	return tenant.FromContext(c.Request.Context())
+}
+
+// routePath returns the matched route with the tenant path prefix removed, so
+// tenant-scoped routes share the authorization rules of their plain form
+func routePath(c *gin.Context) string {
+	return strings.Replace(c.FullPath(), TenantPathPrefix, "", 1)
+}
+
+// subdomainTenant returns the label in front of baseDomain in host, e.g. "acme"
+// for "acme.bridge.example.com"
+func subdomainTenant(host, baseDomain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	suffix := "." + strings.ToLower(strings.TrimPrefix(baseDomain, "."))
+	host = strings.ToLower(host)
+	if baseDomain == "" || !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+
+	label := strings.TrimSuffix(host, suffix)
+	if strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adminTokenRefreshMargin is how long before expiry a cached admin token is refreshed
+const adminTokenRefreshMargin = 30 * time.Second
+
+// adminTokenCall tracks a single in-flight token request shared by all waiting callers
+type adminTokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// adminTokenManager obtains and caches a service-account access token for a
+// provider's management API using the client_credentials grant
+type adminTokenManager struct {
+	tokenURL string
+	client   *http.Client
+	// credentials returns the client authentication and any extra parameters
+	// sent with each token request
+	credentials func() (url.Values, error)
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+	inflight  *adminTokenCall
+}
+
+// newAdminTokenManager creates a token manager authenticating with a client secret
+func newAdminTokenManager(tokenURL, clientID, clientSecret string, client *http.Client) *adminTokenManager {
+	return newAdminTokenManagerWithCredentials(tokenURL, client, func() (url.Values, error) {
+		data := url.Values{}
+		data.Set("client_id", clientID)
+		data.Set("client_secret", clientSecret)
+		return data, nil
+	})
+}
+
+// newAdminTokenManagerWithCredentials creates a token manager whose client
+// authentication parameters are produced by credentials for every request
+func newAdminTokenManagerWithCredentials(tokenURL string, client *http.Client, credentials func() (url.Values, error)) *adminTokenManager {
+	return &adminTokenManager{
+		tokenURL:    tokenURL,
+		client:      client,
+		credentials: credentials,
+	}
+}
+
+// Token returns a valid admin access token, fetching a new one when the cached
+// token is missing or about to expire. Concurrent callers share one refresh.
+func (m *adminTokenManager) Token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	if m.token != "" && time.Now().Before(m.refreshAt) {
+		token := m.token
+		m.mu.Unlock()
+		return token, nil
+	}
+
+	call := m.inflight
+	if call == nil {
+		call = &adminTokenCall{done: make(chan struct{})}
+		m.inflight = call
+		// The refresh outlives the caller that started it, so a cancelled
+		// request does not fail the other callers waiting on the same token.
+		go m.refresh(context.WithoutCancel(ctx), call)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Do performs a JSON request authorized with the managed token. A 401 response
+// invalidates the cached token and the request is retried once with a freshly
+// issued one.
+func (m *adminTokenManager) Do(ctx context.Context, client *http.Client, method, endpoint string, payload []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := m.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain admin token: %w", err)
+		}
+
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute request: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+
+		_ = resp.Body.Close()
+		m.Invalidate(token)
+	}
+}
+
+// Invalidate drops the cached token if it is still the given one, forcing the
+// next Token call to fetch a fresh token
+func (m *adminTokenManager) Invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == token {
+		m.token = ""
+		m.refreshAt = time.Time{}
+	}
+}
+
+// refresh fetches a new token, stores it and releases everyone waiting on call
+func (m *adminTokenManager) refresh(ctx context.Context, call *adminTokenCall) {
+	token, expiresIn, err := m.fetch(ctx)
+
+	m.mu.Lock()
+	if err == nil {
+		margin := adminTokenRefreshMargin
+		if expiresIn <= 2*margin {
+			margin = expiresIn / 2
+		}
+		m.token = token
+		m.refreshAt = time.Now().Add(expiresIn - margin)
+	}
+	call.token, call.err = token, err
+	m.inflight = nil
+	m.mu.Unlock()
+
+	close(call.done)
+}
+
+// fetch requests a new token from the token endpoint
+func (m *adminTokenManager) fetch(ctx context.Context) (string, time.Duration, error) {
+	data, err := m.credentials()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to build client credentials: %w", err)
+	}
+	data.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.tokenURL,
+		strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("admin token request failed with status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if result.AccessToken == "" {
+		return "", 0, fmt.Errorf("admin token response did not contain an access token")
+	}
+
+	return result.AccessToken, time.Duration(result.ExpiresIn) * time.Second, nil
+}
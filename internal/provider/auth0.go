@@ -0,0 +1,365 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// auth0RolesPageSize is the page size used when listing roles
+const auth0RolesPageSize = 50
+
+// auth0User is the subset of an Auth0 user object used by the bridge
+type auth0User struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// auth0Role is the subset of an Auth0 role object used by the bridge
+type auth0Role struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// auth0RolesPage is a page of roles listed with include_totals
+type auth0RolesPage struct {
+	Roles []auth0Role `json:"roles"`
+	Start int         `json:"start"`
+	Total int         `json:"total"`
+}
+
+// Auth0Provider implements IAMProvider on top of Auth0. Token operations use
+// the tenant's OAuth endpoints through the embedded OIDCProvider, and users and
+// roles use the Management API v2.
+type Auth0Provider struct {
+	*OIDCProvider
+
+	config           *config.Auth0Config
+	client           *http.Client
+	baseURL          string
+	managementTokens *adminTokenManager
+}
+
+// Login authenticates a user with the password-realm grant against the
+// configured connection, or the plain password grant when none is set
+func (a *Auth0Provider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	data := url.Values{}
+	if a.config.Connection != "" {
+		data.Set("grant_type", "http://auth0.com/oauth/grant-type/password-realm")
+		data.Set("realm", a.config.Connection)
+	} else {
+		data.Set("grant_type", "password")
+	}
+	data.Set("username", username)
+	data.Set("password", password)
+	if a.config.Audience != "" {
+		data.Set("audience", a.config.Audience)
+	}
+	if len(a.config.Scopes) > 0 {
+		data.Set("scope", strings.Join(a.config.Scopes, " "))
+	}
+
+	return a.requestToken(ctx, data, ErrInvalidCredentials)
+}
+
+// GetUserInfo retrieves user information
+func (a *Auth0Provider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	resp, err := a.doManagementRequest(ctx, "GET", "/users/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var user auth0User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &UserInfo{
+		ID:       user.UserID,
+		UserName: user.Username,
+		Email:    user.Email,
+	}, nil
+}
+
+// UpdateUserInfo applies the non-empty fields of info to a user. The Management
+// API PATCH is partial, so omitted fields keep their current value.
+func (a *Auth0Provider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
+	update := map[string]string{}
+	if info.UserName != "" {
+		update["username"] = info.UserName
+	}
+	if info.Email != "" {
+		update["email"] = info.Email
+	}
+	if len(update) == 0 {
+		// Nothing to change, but still report unknown users
+		_, err := a.GetUserInfo(ctx, userID)
+		return err
+	}
+	// Auth0 requires the connection when changing username or email
+	if a.config.Connection != "" {
+		update["connection"] = a.config.Connection
+	}
+
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to encode user: %w", err)
+	}
+
+	resp, err := a.doManagementRequest(ctx, "PATCH", "/users/"+url.PathEscape(userID), payload)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	case http.StatusConflict:
+		var body struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Message != "" {
+			return fmt.Errorf("%w: %s", ErrUserConflict, body.Message)
+		}
+		return ErrUserConflict
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// AssignRole grants the Auth0 role with the given name to a user
+func (a *Auth0Provider) AssignRole(ctx context.Context, userID string, role string) error {
+	return a.modifyUserRoles(ctx, http.MethodPost, userID, role)
+}
+
+// RemoveRole revokes the Auth0 role with the given name from a user
+func (a *Auth0Provider) RemoveRole(ctx context.Context, userID string, role string) error {
+	return a.modifyUserRoles(ctx, http.MethodDelete, userID, role)
+}
+
+// GetUserRoles returns the names of the Auth0 roles assigned to a user
+func (a *Auth0Provider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	roles := []string{}
+
+	for page := 0; ; page++ {
+		endpoint := fmt.Sprintf("/users/%s/roles?page=%d&per_page=%d",
+			url.PathEscape(userID), page, auth0RolesPageSize)
+
+		resp, err := a.doManagementRequest(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		pageRoles, err := decodeAuth0Roles(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, role := range pageRoles {
+			roles = append(roles, role.Name)
+		}
+
+		if len(pageRoles) < auth0RolesPageSize {
+			return roles, nil
+		}
+	}
+}
+
+// modifyUserRoles adds (POST) or removes (DELETE) a role assignment of a user
+func (a *Auth0Provider) modifyUserRoles(ctx context.Context, method, userID, role string) error {
+	auth0Role, err := a.findRole(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string][]string{"roles": {auth0Role.ID}})
+	if err != nil {
+		return fmt.Errorf("failed to encode roles: %w", err)
+	}
+
+	resp, err := a.doManagementRequest(ctx, method, "/users/"+url.PathEscape(userID)+"/roles", payload)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// findRole looks up a role by its exact name
+func (a *Auth0Provider) findRole(ctx context.Context, name string) (*auth0Role, error) {
+	for page := 0; ; page++ {
+		endpoint := fmt.Sprintf("/roles?name_filter=%s&page=%d&per_page=%d&include_totals=true",
+			url.QueryEscape(name), page, auth0RolesPageSize)
+
+		resp, err := a.doManagementRequest(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		rolesPage, err := decodeAuth0RolesPage(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		// name_filter matches case-insensitively anywhere in the name, so
+		// require the exact name
+		for i := range rolesPage.Roles {
+			if rolesPage.Roles[i].Name == name {
+				return &rolesPage.Roles[i], nil
+			}
+		}
+
+		if len(rolesPage.Roles) == 0 || rolesPage.Start+len(rolesPage.Roles) >= rolesPage.Total {
+			return nil, ErrRoleNotFound
+		}
+	}
+}
+
+// decodeAuth0RolesPage reads a page of roles listed with include_totals from
+// a Management API response
+func decodeAuth0RolesPage(resp *http.Response) (*auth0RolesPage, error) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var page auth0RolesPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &page, nil
+}
+
+// decodeAuth0Roles reads a list of roles from a Management API response
+func decodeAuth0Roles(resp *http.Response) ([]auth0Role, error) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var roles []auth0Role
+	if err := json.NewDecoder(resp.Body).Decode(&roles); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return roles, nil
+}
+
+// doManagementRequest performs an authenticated request against the Management API v2
+func (a *Auth0Provider) doManagementRequest(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	return a.managementTokens.Do(ctx, a.client, method, a.baseURL+"/api/v2"+path, payload)
+}
+
+// NewAuth0Provider creates a new Auth0Provider instance
+func NewAuth0Provider(cfg config.Auth0Config) (IAMProvider, error) {
+	if cfg.Domain == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, fmt.Errorf("missing required Auth0 configuration")
+	}
+
+	switch strings.ToLower(cfg.TokenValidation.Mode) {
+	case "", "remote", "local":
+	default:
+		return nil, fmt.Errorf("invalid Auth0 token validation mode: %s", cfg.TokenValidation.Mode)
+	}
+
+	baseURL := strings.TrimSuffix(cfg.Domain, "/")
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "https://" + baseURL
+	}
+
+	validation := cfg.TokenValidation
+	if len(validation.Audience) == 0 && cfg.Audience != "" {
+		validation.Audience = []string{cfg.Audience}
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	managementClientID, managementClientSecret := cfg.Management.ClientID, cfg.Management.ClientSecret
+	if managementClientID == "" {
+		managementClientID, managementClientSecret = cfg.ClientID, cfg.ClientSecret
+	}
+	managementAudience := baseURL + "/api/v2/"
+
+	return &Auth0Provider{
+		// Auth0's issuer carries a trailing slash
+		OIDCProvider: newOIDCProvider(config.OIDCConfig{
+			Issuer:                  baseURL + "/",
+			ClientID:                cfg.ClientID,
+			ClientSecret:            cfg.ClientSecret,
+			TokenEndpointAuthMethod: "client_secret_post",
+			Scopes:                  cfg.Scopes,
+			TokenValidation:         validation,
+		}, client),
+		config:  &cfg,
+		client:  client,
+		baseURL: baseURL,
+		managementTokens: newAdminTokenManagerWithCredentials(baseURL+"/oauth/token", client, func() (url.Values, error) {
+			data := url.Values{}
+			data.Set("client_id", managementClientID)
+			data.Set("client_secret", managementClientSecret.Value())
+			data.Set("audience", managementAudience)
+			return data, nil
+		}),
+	}, nil
+}
@@ -0,0 +1,66 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+)
+
+func TestAuth0ProviderConformance(t *testing.T) {
+	for _, mode := range []string{"remote", "local"} {
+		t.Run(mode, func(t *testing.T) {
+			providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+				server := providertest.NewAuth0Server(t)
+				f := providertest.Seed(server)
+
+				cfg := server.Config()
+				cfg.TokenValidation.Mode = mode
+
+				p, err := provider.NewAuth0Provider(cfg)
+				if err != nil {
+					t.Fatalf("failed to create provider: %v", err)
+				}
+
+				f.Provider = p
+				return f
+			})
+		})
+	}
+}
+
+func TestAuth0ProviderFindsRolesBeyondFirstPage(t *testing.T) {
+	server := providertest.NewAuth0Server(t)
+	f := providertest.Seed(server)
+
+	// name_filter also matches these roles, which sort before f.Role and
+	// fill the first pages
+	for i := 0; i < 120; i++ {
+		server.AddRole(fmt.Sprintf("legacy-%s-%03d", f.Role, i))
+	}
+
+	p, err := provider.NewAuth0Provider(server.Config())
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := p.AssignRole(ctx, f.UserID, f.Role); err != nil {
+		t.Fatalf("AssignRole returned unexpected error: %v", err)
+	}
+	roles, err := p.GetUserRoles(ctx, f.UserID)
+	if err != nil {
+		t.Fatalf("GetUserRoles returned unexpected error: %v", err)
+	}
+	if !slices.Contains(roles, f.Role) {
+		t.Errorf("GetUserRoles returned %v, want it to contain %s", roles, f.Role)
+	}
+
+	if err := p.AssignRole(ctx, f.UserID, "legacy"); !errors.Is(err, provider.ErrRoleNotFound) {
+		t.Errorf("AssignRole of a partial name returned %v, want %v", err, provider.ErrRoleNotFound)
+	}
+}
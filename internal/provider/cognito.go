@@ -0,0 +1,410 @@
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// CognitoProvider implements IAMProvider on top of an AWS Cognito user pool.
+// Tokens are validated locally against the pool's JWKS and roles map to
+// Cognito groups.
+type CognitoProvider struct {
+	config    *config.CognitoConfig
+	client    *cognitoidentityprovider.Client
+	http      *http.Client
+	jwksURL   string
+	validator *jwtValidator
+}
+
+// Login authenticates a user with the USER_PASSWORD_AUTH flow
+func (c *CognitoProvider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	params := map[string]string{
+		"USERNAME": username,
+		"PASSWORD": password,
+	}
+	if c.config.ClientSecret != "" {
+		params["SECRET_HASH"] = c.secretHash(username)
+	}
+
+	output, err := c.client.InitiateAuth(ctx, &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow:       types.AuthFlowTypeUserPasswordAuth,
+		ClientId:       aws.String(c.config.ClientID),
+		AuthParameters: params,
+	})
+	if err != nil {
+		var notAuthorized *types.NotAuthorizedException
+		var userNotFound *types.UserNotFoundException
+		if errors.As(err, &notAuthorized) || errors.As(err, &userNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to initiate auth: %w", err)
+	}
+
+	if output.AuthenticationResult == nil {
+		return nil, fmt.Errorf("unsupported authentication challenge: %s", output.ChallengeName)
+	}
+
+	return c.tokenSet(output.AuthenticationResult, "")
+}
+
+// RefreshToken exchanges a refresh token for a new token set with the
+// REFRESH_TOKEN_AUTH flow. Cognito returns no new refresh token, so the
+// original one is handed back.
+func (c *CognitoProvider) RefreshToken(ctx context.Context, refreshToken string) (*TokenSet, error) {
+	username, rawToken := splitCognitoRefreshToken(refreshToken)
+
+	params := map[string]string{
+		"REFRESH_TOKEN": rawToken,
+	}
+	if c.config.ClientSecret != "" {
+		if username == "" {
+			return nil, ErrTokenInvalid
+		}
+		params["SECRET_HASH"] = c.secretHash(username)
+	}
+
+	output, err := c.client.InitiateAuth(ctx, &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow:       types.AuthFlowTypeRefreshTokenAuth,
+		ClientId:       aws.String(c.config.ClientID),
+		AuthParameters: params,
+	})
+	if err != nil {
+		var notAuthorized *types.NotAuthorizedException
+		if errors.As(err, &notAuthorized) {
+			return nil, ErrTokenExpired
+		}
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	if output.AuthenticationResult == nil {
+		return nil, fmt.Errorf("unsupported authentication challenge: %s", output.ChallengeName)
+	}
+
+	return c.tokenSet(output.AuthenticationResult, refreshToken)
+}
+
+// ValidateToken verifies the token against the user pool's JWKS. Only access
+// tokens are accepted, as ID tokens are meant for the client and are not
+// revoked by sign-out.
+func (c *CognitoProvider) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	info, err := c.validator.Validate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenUse, _ := info.Claims["token_use"].(string); tokenUse != "access" {
+		return nil, fmt.Errorf("%w: token_use is %q, want access", ErrTokenInvalid, tokenUse)
+	}
+	info.Roles = stringSlice(info.Claims["cognito:groups"])
+
+	return info, nil
+}
+
+// Logout signs the user out. An access token signs out all of the user's
+// sessions with GlobalSignOut, and a refresh token is revoked with RevokeToken.
+func (c *CognitoProvider) Logout(ctx context.Context, token string) error {
+	_, rawToken := splitCognitoRefreshToken(token)
+
+	// Access tokens are signed JWTs (three segments), while refresh tokens
+	// are encrypted JWEs (five segments)
+	if strings.Count(rawToken, ".") == 2 {
+		_, err := c.client.GlobalSignOut(ctx, &cognitoidentityprovider.GlobalSignOutInput{
+			AccessToken: aws.String(rawToken),
+		})
+		if err != nil {
+			var notAuthorized *types.NotAuthorizedException
+			if errors.As(err, &notAuthorized) {
+				return ErrTokenInvalid
+			}
+			return fmt.Errorf("failed to sign out: %w", err)
+		}
+		return nil
+	}
+
+	input := &cognitoidentityprovider.RevokeTokenInput{
+		ClientId: aws.String(c.config.ClientID),
+		Token:    aws.String(rawToken),
+	}
+	if c.config.ClientSecret != "" {
+		input.ClientSecret = aws.String(c.config.ClientSecret.Value())
+	}
+
+	if _, err := c.client.RevokeToken(ctx, input); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserInfo retrieves user information. The user ID is the Cognito username.
+func (c *CognitoProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	output, err := c.client.AdminGetUser(ctx, &cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: aws.String(c.config.UserPoolID),
+		Username:   aws.String(userID),
+	})
+	if err != nil {
+		return nil, mapCognitoUserError(err)
+	}
+
+	user := &UserInfo{
+		ID:       aws.ToString(output.Username),
+		UserName: aws.ToString(output.Username),
+	}
+	for _, attribute := range output.UserAttributes {
+		switch aws.ToString(attribute.Name) {
+		case "sub":
+			user.ID = aws.ToString(attribute.Value)
+		case "email":
+			user.Email = aws.ToString(attribute.Value)
+		}
+	}
+
+	return user, nil
+}
+
+// UpdateUserInfo applies a non-empty email to the user. Cognito usernames are
+// immutable, so a username change is reported as unsupported.
+func (c *CognitoProvider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
+	if info.UserName != "" && info.UserName != userID {
+		return &UnsupportedOperationError{Provider: "cognito", Operation: "changing the username"}
+	}
+
+	if info.Email == "" {
+		// Nothing to change, but still report unknown users
+		_, err := c.GetUserInfo(ctx, userID)
+		return err
+	}
+
+	_, err := c.client.AdminUpdateUserAttributes(ctx, &cognitoidentityprovider.AdminUpdateUserAttributesInput{
+		UserPoolId: aws.String(c.config.UserPoolID),
+		Username:   aws.String(userID),
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(info.Email)},
+		},
+	})
+	if err != nil {
+		var aliasExists *types.AliasExistsException
+		if errors.As(err, &aliasExists) {
+			return fmt.Errorf("%w: %s", ErrUserConflict, aliasExists.ErrorMessage())
+		}
+		return mapCognitoUserError(err)
+	}
+
+	return nil
+}
+
+// AssignRole adds the user to the Cognito group named role
+func (c *CognitoProvider) AssignRole(ctx context.Context, userID string, role string) error {
+	_, err := c.client.AdminAddUserToGroup(ctx, &cognitoidentityprovider.AdminAddUserToGroupInput{
+		UserPoolId: aws.String(c.config.UserPoolID),
+		Username:   aws.String(userID),
+		GroupName:  aws.String(role),
+	})
+	if err != nil {
+		return mapCognitoGroupError(err)
+	}
+	return nil
+}
+
+// RemoveRole removes the user from the Cognito group named role
+func (c *CognitoProvider) RemoveRole(ctx context.Context, userID string, role string) error {
+	_, err := c.client.AdminRemoveUserFromGroup(ctx, &cognitoidentityprovider.AdminRemoveUserFromGroupInput{
+		UserPoolId: aws.String(c.config.UserPoolID),
+		Username:   aws.String(userID),
+		GroupName:  aws.String(role),
+	})
+	if err != nil {
+		return mapCognitoGroupError(err)
+	}
+	return nil
+}
+
+// GetUserRoles returns the names of the Cognito groups the user belongs to
+func (c *CognitoProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	roles := []string{}
+
+	paginator := cognitoidentityprovider.NewAdminListGroupsForUserPaginator(c.client,
+		&cognitoidentityprovider.AdminListGroupsForUserInput{
+			UserPoolId: aws.String(c.config.UserPoolID),
+			Username:   aws.String(userID),
+		})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, mapCognitoUserError(err)
+		}
+		for _, group := range page.Groups {
+			roles = append(roles, aws.ToString(group.GroupName))
+		}
+	}
+
+	return roles, nil
+}
+
+// HealthCheck verifies that the user pool's JWKS endpoint is reachable
+func (c *CognitoProvider) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.jwksURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// tokenSet converts a Cognito authentication result. With a client secret,
+// the refresh token is prefixed with the username needed to compute the
+// SECRET_HASH on refresh, since Cognito refresh tokens are opaque.
+func (c *CognitoProvider) tokenSet(result *types.AuthenticationResultType, refreshToken string) (*TokenSet, error) {
+	tokens := &TokenSet{
+		AccessToken:  aws.ToString(result.AccessToken),
+		RefreshToken: refreshToken,
+		IDToken:      aws.ToString(result.IdToken),
+		TokenType:    aws.ToString(result.TokenType),
+		ExpiresIn:    int64(result.ExpiresIn),
+	}
+
+	if result.RefreshToken != nil {
+		tokens.RefreshToken = aws.ToString(result.RefreshToken)
+		if c.config.ClientSecret != "" {
+			claims := jwt.MapClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, claims); err != nil {
+				return nil, fmt.Errorf("failed to parse access token: %w", err)
+			}
+			username, _ := claims["username"].(string)
+			tokens.RefreshToken = base64.RawURLEncoding.EncodeToString([]byte(username)) + "." + tokens.RefreshToken
+		}
+	}
+
+	return tokens, nil
+}
+
+// secretHash computes the SECRET_HASH parameter required for app clients with a secret
+func (c *CognitoProvider) secretHash(username string) string {
+	mac := hmac.New(sha256.New, []byte(c.config.ClientSecret))
+	mac.Write([]byte(username + c.config.ClientID))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// splitCognitoRefreshToken separates the username prefix added by tokenSet
+// from the Cognito refresh token. Tokens without a prefix are returned as-is.
+func splitCognitoRefreshToken(token string) (string, string) {
+	prefix, rest, found := strings.Cut(token, ".")
+	// Cognito's own tokens are JWTs or JWEs whose first segment is a JSON header
+	if !found || strings.HasPrefix(prefix, "eyJ") {
+		return "", token
+	}
+
+	username, err := base64.RawURLEncoding.DecodeString(prefix)
+	if err != nil {
+		return "", token
+	}
+
+	return string(username), rest
+}
+
+// mapCognitoUserError maps Cognito user lookup errors to provider errors
+func mapCognitoUserError(err error) error {
+	var userNotFound *types.UserNotFoundException
+	if errors.As(err, &userNotFound) {
+		return ErrUserNotFound
+	}
+	return fmt.Errorf("cognito request failed: %w", err)
+}
+
+// mapCognitoGroupError maps group membership errors, where a missing group is
+// reported as a ResourceNotFoundException
+func mapCognitoGroupError(err error) error {
+	var resourceNotFound *types.ResourceNotFoundException
+	if errors.As(err, &resourceNotFound) {
+		return ErrRoleNotFound
+	}
+	return mapCognitoUserError(err)
+}
+
+// NewCognitoProvider creates a new CognitoProvider instance
+func NewCognitoProvider(cfg config.CognitoConfig) (IAMProvider, error) {
+	if cfg.Region == "" || cfg.UserPoolID == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("missing required Cognito configuration")
+	}
+
+	switch strings.ToLower(cfg.TokenValidation.Mode) {
+	case "", "local":
+	default:
+		return nil, fmt.Errorf("invalid Cognito token validation mode: %s (only local is supported)", cfg.TokenValidation.Mode)
+	}
+
+	httpClient := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	// The AWS client must be buildable for the SDK to apply settings such as
+	// AWS_CA_BUNDLE, which a plain http.Client rejects
+	options := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(cfg.Region),
+		awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(httpClient.Timeout)),
+	}
+	if cfg.AccessKeyID != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey.Value(), "")))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	client := cognitoidentityprovider.NewFromConfig(awsCfg, func(o *cognitoidentityprovider.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	issuer := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", cfg.Region, cfg.UserPoolID)
+	if cfg.Endpoint != "" {
+		issuer = fmt.Sprintf("%s/%s", strings.TrimSuffix(cfg.Endpoint, "/"), cfg.UserPoolID)
+	}
+	jwksURL := issuer + "/.well-known/jwks.json"
+	if cfg.TokenValidation.Issuer != "" {
+		issuer = cfg.TokenValidation.Issuer
+	}
+
+	return &CognitoProvider{
+		config:    &cfg,
+		client:    client,
+		http:      httpClient,
+		jwksURL:   jwksURL,
+		validator: newJWTValidator(&cfg.TokenValidation, jwksURL, issuer, cfg.ClientID, httpClient),
+	}, nil
+}
@@ -0,0 +1,55 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+)
+
+func TestCognitoProviderConformance(t *testing.T) {
+	for name, clientSecret := range map[string]string{"public": "", "confidential": "iam-bridge-secret"} {
+		t.Run(name, func(t *testing.T) {
+			providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+				server := providertest.NewCognitoServer(t)
+				server.ClientSecret = clientSecret
+				// Page through groups one at a time
+				server.PageSize = 1
+				f := providertest.Seed(server)
+
+				p, err := provider.NewCognitoProvider(server.Config())
+				if err != nil {
+					t.Fatalf("failed to create provider: %v", err)
+				}
+
+				f.Provider = p
+				return f
+			})
+		})
+	}
+}
+
+func TestCognitoProviderRejectsIDTokens(t *testing.T) {
+	server := providertest.NewCognitoServer(t)
+	f := providertest.Seed(server)
+
+	p, err := provider.NewCognitoProvider(server.Config())
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	ctx := context.Background()
+
+	tokens, err := p.Login(ctx, f.Username, f.Password)
+	if err != nil {
+		t.Fatalf("Login returned unexpected error: %v", err)
+	}
+	if tokens.IDToken == "" {
+		t.Fatal("Login returned no ID token")
+	}
+
+	if _, err := p.ValidateToken(ctx, tokens.IDToken); !errors.Is(err, provider.ErrTokenInvalid) {
+		t.Errorf("ValidateToken of an ID token returned %v, want %v", err, provider.ErrTokenInvalid)
+	}
+}
@@ -0,0 +1,412 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
+)
+
+const (
+	// CompositeFirstSuccess logs users in on the first backend that accepts them
+	CompositeFirstSuccess = "first-success"
+	// CompositePrimaryWithFallback logs users in on the first healthy backend
+	CompositePrimaryWithFallback = "primary-with-fallback"
+	// CompositeRouteByUsernameDomain logs users in on the backend serving the
+	// domain of their username
+	CompositeRouteByUsernameDomain = "route-by-username-domain"
+)
+
+// compositeBackend is a provider chained by the composite provider
+type compositeBackend struct {
+	name     string
+	provider IAMProvider
+	config   config.CompositeBackend
+}
+
+// CompositeProvider implements IAMProvider on top of an ordered list of other
+// providers, so several backends can serve users side by side, for example
+// during a migration.
+//
+// Login follows the configured strategy. Tokens are offered to every backend,
+// starting with the preferred one, until one accepts them. User and role
+// operations go to the first backend that knows the user ID.
+type CompositeProvider struct {
+	config   *config.CompositeConfig
+	logger   logger.Logger
+	backends []*compositeBackend
+
+	mu sync.RWMutex
+	// active is the backend index primary-with-fallback currently logs in on
+	active int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Login authenticates the user on the backend chosen by the strategy
+func (c *CompositeProvider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	switch c.config.Strategy {
+	case CompositePrimaryWithFallback:
+		return c.activeBackend().provider.Login(ctx, username, password)
+	case CompositeRouteByUsernameDomain:
+		backend, err := c.routeUsername(username)
+		if err != nil {
+			return nil, err
+		}
+		return backend.provider.Login(ctx, backendUsername(backend, username), password)
+	default:
+		var tokens *TokenSet
+		err := c.try(c.backends, func(backend *compositeBackend) error {
+			var err error
+			tokens, err = backend.provider.Login(ctx, backendUsername(backend, username), password)
+			return err
+		}, ErrInvalidCredentials)
+		return tokens, err
+	}
+}
+
+// Logout invalidates the token on the backend that accepts it
+func (c *CompositeProvider) Logout(ctx context.Context, token string) error {
+	return c.try(c.preferred(), func(backend *compositeBackend) error {
+		return backend.provider.Logout(ctx, token)
+	}, ErrTokenExpired, ErrTokenInvalid)
+}
+
+// ValidateToken validates the token on the backend that accepts it
+func (c *CompositeProvider) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	var info *TokenInfo
+	err := c.try(c.preferred(), func(backend *compositeBackend) error {
+		var err error
+		info, err = backend.provider.ValidateToken(ctx, token)
+		return err
+	}, ErrTokenExpired, ErrTokenInvalid)
+	return info, err
+}
+
+// RefreshToken refreshes the token on the backend that accepts it
+func (c *CompositeProvider) RefreshToken(ctx context.Context, refreshToken string) (*TokenSet, error) {
+	var tokens *TokenSet
+	err := c.try(c.preferred(), func(backend *compositeBackend) error {
+		var err error
+		tokens, err = backend.provider.RefreshToken(ctx, refreshToken)
+		return err
+	}, ErrTokenExpired, ErrTokenInvalid, ErrUnsupportedOperation)
+	return tokens, err
+}
+
+// GetUserInfo retrieves user information from the backend that knows the user
+func (c *CompositeProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	var info *UserInfo
+	err := c.try(c.backends, func(backend *compositeBackend) error {
+		var err error
+		info, err = backend.provider.GetUserInfo(ctx, userID)
+		return err
+	}, ErrUserNotFound, ErrUnsupportedOperation)
+	return info, err
+}
+
+// UpdateUserInfo updates the user on the backend that knows the user
+func (c *CompositeProvider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
+	backend, err := c.backendForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return backend.provider.UpdateUserInfo(ctx, userID, info)
+}
+
+// AssignRole grants a role on the backend that knows the user
+func (c *CompositeProvider) AssignRole(ctx context.Context, userID string, role string) error {
+	backend, err := c.backendForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return backend.provider.AssignRole(ctx, userID, role)
+}
+
+// RemoveRole revokes a role on the backend that knows the user
+func (c *CompositeProvider) RemoveRole(ctx context.Context, userID string, role string) error {
+	backend, err := c.backendForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return backend.provider.RemoveRole(ctx, userID, role)
+}
+
+// GetUserRoles returns the user's roles from the backend that knows the user
+func (c *CompositeProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	backend, err := c.backendForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return backend.provider.GetUserRoles(ctx, userID)
+}
+
+// HealthCheck reports whether users can log in. With primary-with-fallback
+// one healthy backend is enough, otherwise every backend must be healthy.
+func (c *CompositeProvider) HealthCheck(ctx context.Context) error {
+	var errs []error
+	for _, backend := range c.backends {
+		if err := backend.provider.HealthCheck(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.name, err))
+		}
+	}
+
+	if c.config.Strategy == CompositePrimaryWithFallback && len(errs) < len(c.backends) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the health checks and closes the backends that hold resources
+func (c *CompositeProvider) Close() error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+
+	var errs []error
+	for _, backend := range c.backends {
+		if err := closeProvider(backend.provider); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// try calls fn on each backend in order until one succeeds. When all fail and
+// every error is one of expected, the first of expected that occurred is
+// returned, so a token rejected as expired by one backend and as invalid by
+// another is reported as expired. Otherwise the first unexpected error is
+// returned.
+func (c *CompositeProvider) try(backends []*compositeBackend, fn func(backend *compositeBackend) error, expected ...error) error {
+	var errs []error
+	var unexpected error
+	for _, backend := range backends {
+		err := fn(backend)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err)
+		if unexpected == nil && !isAnyOf(err, expected) {
+			unexpected = fmt.Errorf("%s: %w", backend.name, err)
+		}
+	}
+
+	if unexpected != nil {
+		return unexpected
+	}
+	for _, target := range expected {
+		for _, err := range errs {
+			if errors.Is(err, target) {
+				return err
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backendForUser returns the first backend that knows the user ID
+func (c *CompositeProvider) backendForUser(ctx context.Context, userID string) (*compositeBackend, error) {
+	var owner *compositeBackend
+	err := c.try(c.backends, func(backend *compositeBackend) error {
+		if _, err := backend.provider.GetUserInfo(ctx, userID); err != nil {
+			return err
+		}
+		owner = backend
+		return nil
+	}, ErrUserNotFound, ErrUnsupportedOperation)
+	return owner, err
+}
+
+// routeUsername returns the backend serving the domain of the username, or
+// the backend without domains when no backend claims it
+func (c *CompositeProvider) routeUsername(username string) (*compositeBackend, error) {
+	var fallback *compositeBackend
+	domain := usernameDomain(username)
+	for _, backend := range c.backends {
+		if len(backend.config.Domains) == 0 {
+			if fallback == nil {
+				fallback = backend
+			}
+			continue
+		}
+		for _, candidate := range backend.config.Domains {
+			if domain != "" && strings.EqualFold(candidate, domain) {
+				return backend, nil
+			}
+		}
+	}
+
+	if fallback == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return fallback, nil
+}
+
+// preferred returns the backends in the order tokens are offered to them: the
+// active backend first with primary-with-fallback, otherwise configuration order
+func (c *CompositeProvider) preferred() []*compositeBackend {
+	if c.config.Strategy != CompositePrimaryWithFallback {
+		return c.backends
+	}
+
+	active := c.activeBackend()
+	ordered := make([]*compositeBackend, 0, len(c.backends))
+	ordered = append(ordered, active)
+	for _, backend := range c.backends {
+		if backend != active {
+			ordered = append(ordered, backend)
+		}
+	}
+	return ordered
+}
+
+// activeBackend returns the backend primary-with-fallback currently logs in on
+func (c *CompositeProvider) activeBackend() *compositeBackend {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.backends[c.active]
+}
+
+// monitor checks backend health until the provider is closed
+func (c *CompositeProvider) monitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.checkBackends(interval)
+	for {
+		select {
+		case <-ticker.C:
+			c.checkBackends(interval)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// checkBackends makes the first healthy backend the active one. When no
+// backend is healthy the active backend is kept.
+func (c *CompositeProvider) checkBackends(timeout time.Duration) {
+	for i, backend := range c.backends {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := backend.provider.HealthCheck(ctx)
+		cancel()
+		if err != nil {
+			c.logger.Error("Composite backend failed health check",
+				logger.String("backend", backend.name), logger.Err(err))
+			continue
+		}
+
+		c.mu.Lock()
+		previous := c.active
+		c.active = i
+		c.mu.Unlock()
+
+		if previous != i {
+			c.logger.Info("Composite provider switched backend",
+				logger.String("from", c.backends[previous].name), logger.String("to", backend.name))
+		}
+		return
+	}
+}
+
+// backendUsername returns the username as sent to the backend
+func backendUsername(backend *compositeBackend, username string) string {
+	if backend.config.StripDomain {
+		if i := strings.LastIndex(username, "@"); i >= 0 {
+			return username[:i]
+		}
+	}
+	return username
+}
+
+// usernameDomain returns the part of the username after the last "@"
+func usernameDomain(username string) string {
+	if i := strings.LastIndex(username, "@"); i >= 0 {
+		return username[i+1:]
+	}
+	return ""
+}
+
+// isAnyOf reports whether err matches any of targets
+func isAnyOf(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCompositeProvider creates a new CompositeProvider, building each backend
+// from its provider block in cfg
+func NewCompositeProvider(cfg *config.IAMConfig, log logger.Logger) (IAMProvider, error) {
+	if log == nil {
+		log = logger.FromContext(context.Background())
+	}
+
+	composite := cfg.Composite
+
+	strategy := strings.ToLower(composite.Strategy)
+	switch strategy {
+	case "":
+		strategy = CompositeFirstSuccess
+	case CompositeFirstSuccess, CompositePrimaryWithFallback, CompositeRouteByUsernameDomain:
+	default:
+		return nil, fmt.Errorf("invalid composite strategy: %s", composite.Strategy)
+	}
+	composite.Strategy = strategy
+
+	if len(composite.Backends) == 0 {
+		return nil, errors.New("composite provider requires at least one backend")
+	}
+
+	provider := &CompositeProvider{
+		config: &composite,
+		logger: log,
+		stop:   make(chan struct{}),
+	}
+
+	seen := make(map[string]bool)
+	for _, backendCfg := range composite.Backends {
+		name := strings.ToLower(backendCfg.Provider)
+		if name == "composite" {
+			return nil, errors.New("composite provider cannot chain itself")
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate composite backend: %s", name)
+		}
+		seen[name] = true
+
+		backendIAM := *cfg
+		backendIAM.Provider = name
+		backend, err := NewIAMProvider(&backendIAM, log)
+		if err != nil {
+			_ = provider.Close()
+			return nil, fmt.Errorf("failed to create composite backend %s: %w", name, err)
+		}
+
+		provider.backends = append(provider.backends, &compositeBackend{
+			name:     name,
+			provider: backend,
+			config:   backendCfg,
+		})
+	}
+
+	if strategy == CompositePrimaryWithFallback {
+		interval := composite.HealthCheckInterval
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		go provider.monitor(interval)
+	}
+
+	return provider, nil
+}
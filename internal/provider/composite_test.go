@@ -0,0 +1,74 @@
+package provider_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+)
+
+func TestCompositeProviderConformance(t *testing.T) {
+	strategies := []string{
+		provider.CompositeFirstSuccess,
+		provider.CompositePrimaryWithFallback,
+		provider.CompositeRouteByUsernameDomain,
+	}
+
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+				server := providertest.NewKeycloakServer(t)
+				server.AddRole("users:read")
+				server.AddRole("users:admin")
+				carol := server.AddUser(providertest.User{
+					Username: "carol@corp.example.com",
+					Email:    "carol@corp.example.com",
+					Password: "carol-password",
+					Roles:    []string{"users:read"},
+				})
+				server.AddUser(providertest.User{
+					Username: "dave@corp.example.com",
+					Email:    "dave@corp.example.com",
+					Password: "dave-password",
+				})
+
+				cfg := &config.IAMConfig{
+					Provider: "composite",
+					Keycloak: server.Config(),
+					Static: config.StaticConfig{
+						File: filepath.Join("..", "..", "config", "users.example.yaml"),
+						Session: config.SessionTokenConfig{
+							SigningKey: "providertest-signing-key-0123456789",
+						},
+					},
+					Composite: config.CompositeConfig{
+						Strategy: strategy,
+						Backends: []config.CompositeBackend{
+							{Provider: "keycloak", Domains: []string{"corp.example.com"}},
+							{Provider: "static"},
+						},
+					},
+				}
+
+				p, err := provider.NewIAMProvider(cfg, nil)
+				if err != nil {
+					t.Fatalf("failed to create provider: %v", err)
+				}
+				t.Cleanup(func() {
+					_ = p.(*provider.CompositeProvider).Close()
+				})
+
+				return &providertest.Fixture{
+					Provider:      p,
+					UserID:        carol.ID,
+					Username:      carol.Username,
+					Password:      carol.Password,
+					Role:          "users:admin",
+					OtherUsername: "dave@corp.example.com",
+				}
+			})
+		})
+	}
+}
@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/zahidhasanpapon/iam-bridge/internal/config"
 	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
 )
@@ -12,16 +13,56 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrTokenExpired       = errors.New("token expired")
 	ErrTokenInvalid       = errors.New("token invalid")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrUserConflict       = errors.New("user conflict")
+
+	ErrUnsupportedOperation = errors.New("unsupported operation")
+
+	// ErrTenantRequired is returned when a multi-tenant provider is called
+	// without a tenant and has no default
+	ErrTenantRequired = errors.New("tenant required")
+	// ErrTenantNotFound is returned for tenants the provider is not configured for
+	ErrTenantNotFound = errors.New("tenant not found")
 )
 
+// UnsupportedOperationError is returned by providers for IAMProvider methods
+// their backend cannot perform. It matches ErrUnsupportedOperation with errors.Is.
+type UnsupportedOperationError struct {
+	Provider  string
+	Operation string
+}
+
+func (e *UnsupportedOperationError) Error() string {
+	return fmt.Sprintf("%s provider does not support %s", e.Provider, e.Operation)
+}
+
+// Is reports whether target is ErrUnsupportedOperation
+func (e *UnsupportedOperationError) Is(target error) bool {
+	return target == ErrUnsupportedOperation
+}
+
+// TokenSet represents the OAuth2 tokens issued by a provider on login or refresh
+type TokenSet struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	IDToken          string `json:"id_token,omitempty"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+}
+
 // TokenInfo represents the information extracted from a token
 type TokenInfo struct {
-	UserID    string                 `json:"user_id"`
-	Username  string                 `json:"username"`
-	Email     string                 `json:"email"`
-	Roles     []string               `json:"roles"`
-	Claims    map[string]interface{} `json:"claims"`
-	ExpiresAt int64                  `json:"expires_at"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	// Roles holds the realm (global) roles of the user
+	Roles []string `json:"roles"`
+	// ClientRoles holds client-scoped roles keyed by client ID
+	ClientRoles map[string][]string    `json:"client_roles,omitempty"`
+	Claims      map[string]interface{} `json:"claims"`
+	ExpiresAt   int64                  `json:"expires_at"`
 }
 
 // UserInfo represents the information of a user
@@ -34,10 +75,10 @@ type UserInfo struct {
 
 // IAMProvider defines the interface for all IAM providers must implement
 type IAMProvider interface {
-	Login(ctx context.Context, username, password string) (string, error)
+	Login(ctx context.Context, username, password string) (*TokenSet, error)
 	Logout(ctx context.Context, token string) error
 	ValidateToken(ctx context.Context, token string) (*TokenInfo, error)
-	RefreshToken(ctx context.Context, token string) (string, error)
+	RefreshToken(ctx context.Context, token string) (*TokenSet, error)
 
 	GetUserInfo(ctx context.Context, userID string) (*UserInfo, error)
 	UpdateUserInfo(ctx context.Context, userID string, userInfo *UserInfo) error
@@ -50,10 +91,24 @@ type IAMProvider interface {
 }
 
 // NewIAMProvider creates a new IAM provider based on the given configuration
-func NewIAMProvider(cfg *config.IAMConfig, log *logger.Logger) (IAMProvider, error) {
+func NewIAMProvider(cfg *config.IAMConfig, log logger.Logger) (IAMProvider, error) {
 	switch cfg.CurrentProvider() {
 	case "keycloak":
-		return NewKeycloakProvider(cfg.Keycloak, log)
+		return NewKeycloakProvider(cfg.Keycloak)
+	case "oidc":
+		return NewOIDCProvider(cfg.OIDC)
+	case "okta":
+		return NewOktaProvider(cfg.Okta)
+	case "auth0":
+		return NewAuth0Provider(cfg.Auth0)
+	case "cognito":
+		return NewCognitoProvider(cfg.Cognito)
+	case "ldap":
+		return NewLDAPProvider(cfg.LDAP)
+	case "static":
+		return NewStaticProvider(cfg.Static)
+	case "composite":
+		return NewCompositeProvider(cfg, log)
 	default:
 		return nil, errors.New("invalid IAM provider")
 	}
@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errJWKSUnavailable is returned when the key set cannot be fetched, as opposed
+// to a token that references a key the provider does not publish
+var errJWKSUnavailable = errors.New("JWKS unavailable")
+
+// jsonWebKey is the subset of RFC 7517 key fields needed to verify signatures
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwksCache fetches and caches the signing keys published at a JWKS endpoint.
+// Keys are refetched when the cache is older than ttl, or when a token names an
+// unknown key id, but never more often than minRefreshInterval.
+type jwksCache struct {
+	url                string
+	client             *http.Client
+	ttl                time.Duration
+	minRefreshInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+
+	fetchMu     sync.Mutex
+	lastAttempt time.Time
+}
+
+// newJWKSCache creates a key cache for the given JWKS endpoint
+func newJWKSCache(jwksURL string, client *http.Client, ttl, minRefreshInterval time.Duration) *jwksCache {
+	return &jwksCache{
+		url:                jwksURL,
+		client:             client,
+		ttl:                ttl,
+		minRefreshInterval: minRefreshInterval,
+	}
+}
+
+// key returns the public key with the given key id. An empty kid is accepted
+// when the key set contains exactly one key.
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, fresh := c.lookup(kid); key != nil && fresh {
+		return key, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	// Another caller may have refreshed the set while we waited for the lock
+	key, fresh := c.lookup(kid)
+	if key != nil && fresh {
+		return key, nil
+	}
+
+	if time.Since(c.lastAttempt) < c.minRefreshInterval {
+		if key != nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrTokenInvalid, kid)
+	}
+
+	c.lastAttempt = time.Now()
+	if err := c.refresh(ctx); err != nil {
+		// Keep serving a stale key rather than failing every request while
+		// the provider is briefly unreachable
+		if key != nil {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	if key, _ := c.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key id %q", ErrTokenInvalid, kid)
+}
+
+// lookup returns the cached key for kid and whether the cache is still fresh
+func (c *jwksCache) lookup(kid string) (crypto.PublicKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	fresh := !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.ttl
+
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, fresh
+		}
+	}
+
+	return c.keys[kid], fresh
+}
+
+// refresh downloads the key set and replaces the cached keys
+func (c *jwksCache) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create request: %v", errJWKSUnavailable, err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to execute request: %v", errJWKSUnavailable, err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: unexpected status code: %d", errJWKSUnavailable, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("%w: failed to decode response: %v", errJWKSUnavailable, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys of unsupported types instead of rejecting the whole set
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+
+	return nil
+}
+
+// publicKey converts the JWK into an RSA or ECDSA public key
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > int64(^uint32(0)>>1) {
+			return nil, fmt.Errorf("RSA exponent out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// jwtSigningMethods lists the asymmetric algorithms accepted for locally validated tokens
+var jwtSigningMethods = []string{
+	"RS256", "RS384", "RS512",
+	"ES256", "ES384", "ES512",
+	"PS256", "PS384", "PS512",
+}
+
+// jwtValidator verifies signed JWTs against a provider's JWKS without calling
+// the provider for every request
+type jwtValidator struct {
+	jwks      *jwksCache
+	issuer    string
+	audiences []string
+	// authorizedParty is accepted in place of a configured audience, matching
+	// either the aud claim or the claim naming the client the token was issued
+	// to. Keycloak access tokens usually carry the requesting client only in azp.
+	authorizedParty string
+	// tokenType, when set, must match the typ claim, for providers that sign
+	// ID and access tokens with the same keys and tell them apart by typ
+	tokenType string
+	clockSkew time.Duration
+}
+
+// newJWTValidator creates a validator for tokens signed with the keys at jwksURL,
+// applying defaults for cache settings left unset in the configuration
+func newJWTValidator(validation *config.TokenValidationConfig, jwksURL, issuer, authorizedParty string, client *http.Client) *jwtValidator {
+	cacheTTL := validation.JWKSCacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = time.Hour
+	}
+
+	minRefreshInterval := validation.JWKSMinRefreshInterval
+	if minRefreshInterval <= 0 {
+		minRefreshInterval = time.Minute
+	}
+
+	return &jwtValidator{
+		jwks:            newJWKSCache(jwksURL, client, cacheTTL, minRefreshInterval),
+		issuer:          issuer,
+		audiences:       validation.Audience,
+		authorizedParty: authorizedParty,
+		clockSkew:       validation.ClockSkew,
+	}
+}
+
+// Validate verifies the token signature and its registered claims, and returns
+// the token information carried by the claims
+func (v *jwtValidator) Validate(ctx context.Context, token string) (*TokenInfo, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithLeeway(v.clockSkew),
+		jwt.WithExpirationRequired(),
+	}
+	if v.issuer != "" {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+	if len(v.audiences) > 0 {
+		options = append(options, jwt.WithAudience(v.audiences...))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.jwks.key(ctx, kid)
+	}, options...)
+	if err != nil {
+		switch {
+		case errors.Is(err, errJWKSUnavailable):
+			return nil, err
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrTokenExpired
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+		}
+	}
+
+	if typ, _ := claims["typ"].(string); v.tokenType != "" && typ != v.tokenType {
+		return nil, fmt.Errorf("%w: token type is %q, want %q", ErrTokenInvalid, typ, v.tokenType)
+	}
+	if len(v.audiences) == 0 && v.authorizedParty != "" && !v.hasAuthorizedParty(claims) {
+		return nil, fmt.Errorf("%w: token was not issued for %q", ErrTokenInvalid, v.authorizedParty)
+	}
+
+	return tokenInfoFromClaims(claims), nil
+}
+
+// hasAuthorizedParty reports whether the authorized party appears in the aud
+// claim or one of the claims naming the client a token was issued to
+func (v *jwtValidator) hasAuthorizedParty(claims jwt.MapClaims) bool {
+	// azp is the OIDC claim, client_id comes from RFC 9068 and cid is used by Okta
+	for _, claim := range []string{"azp", "client_id", "cid"} {
+		if party, _ := claims[claim].(string); party == v.authorizedParty {
+			return true
+		}
+	}
+
+	audiences, err := claims.GetAudience()
+	if err != nil {
+		return false
+	}
+	for _, aud := range audiences {
+		if aud == v.authorizedParty {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokenInfoFromClaims maps standard OIDC and Keycloak claims onto TokenInfo.
+// It is shared by local validation and the userinfo response, which carries
+// the same claims when the realm's role mappers are added to userinfo.
+func tokenInfoFromClaims(claims map[string]interface{}) *TokenInfo {
+	info := &TokenInfo{
+		Claims: claims,
+	}
+
+	info.UserID, _ = claims["sub"].(string)
+	info.Username, _ = claims["preferred_username"].(string)
+	if info.Username == "" {
+		// Token introspection responses (RFC 7662) use "username"
+		info.Username, _ = claims["username"].(string)
+	}
+	info.Email, _ = claims["email"].(string)
+
+	if exp, ok := claims["exp"].(float64); ok {
+		info.ExpiresAt = int64(exp)
+	}
+
+	// realm_access is an object of the form {"roles": [...]}
+	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
+		info.Roles = stringSlice(realmAccess["roles"])
+	}
+
+	// resource_access maps each client ID to an object of the same shape
+	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok {
+		for client, access := range resourceAccess {
+			clientAccess, ok := access.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			roles := stringSlice(clientAccess["roles"])
+			if len(roles) == 0 {
+				continue
+			}
+			if info.ClientRoles == nil {
+				info.ClientRoles = make(map[string][]string)
+			}
+			info.ClientRoles[client] = roles
+		}
+	}
+
+	return info
+}
+
+// stringSlice converts a decoded JSON array into a slice of its string elements
+func stringSlice(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/tenant"
 	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
 	"io"
 	"net/http"
@@ -13,35 +14,67 @@ import (
 	"time"
 )
 
+// keycloakRole is the subset of Keycloak's RoleRepresentation used by the bridge
+type keycloakRole struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Composite   bool   `json:"composite"`
+	ClientRole  bool   `json:"clientRole"`
+	ContainerID string `json:"containerId,omitempty"`
+}
+
+// keycloakRealm holds the realm and client a request is served with, and the
+// admin token and signing keys that belong to them
+type keycloakRealm struct {
+	baseURL      string
+	name         string
+	clientID     string
+	clientSecret string
+	adminTokens  *adminTokenManager
+	validator    *jwtValidator
+}
+
+// KeycloakProvider implements IAMProvider for Keycloak. Requests carrying a
+// tenant (see the tenant package) are served by that tenant's realm, so tokens
+// issued for one tenant are rejected by every other.
 type KeycloakProvider struct {
 	config *config.KeycloakConfig
-	logger *logger.Logger
 	client *http.Client
+	// defaultRealm serves requests without a tenant and is nil when only
+	// tenants are configured
+	defaultRealm *keycloakRealm
+	tenants      map[string]*keycloakRealm
 }
 
-// Login authenticates a user and returns an access token
-func (k *KeycloakProvider) Login(ctx context.Context, username, password string) (string, error) {
+// Login authenticates a user and returns the issued token set
+func (k *KeycloakProvider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	data := url.Values{}
 	data.Set("grant_type", "password")
-	data.Set("client_id", k.config.ClientID)
-	data.Set("client_secret", k.config.ClientSecret)
+	data.Set("client_id", realm.clientID)
+	data.Set("client_secret", realm.clientSecret)
 	data.Set("username", username)
 	data.Set("password", password)
 
 	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token",
-		k.config.BaseURL, k.config.Realm)
+		realm.baseURL, realm.name)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL,
 		strings.NewReader(data.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := k.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute request: %w", err)
+		return nil, k.requestFailed(ctx, realm, "login", err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -52,26 +85,36 @@ func (k *KeycloakProvider) Login(ctx context.Context, username, password string)
 
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusUnauthorized {
-			return "", ErrInvalidCredentials
+			k.log(ctx, realm).Debug("Keycloak rejected login credentials")
+			return nil, ErrInvalidCredentials
 		}
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	var result struct {
-		AccessToken string `json:"access_token"`
+		return nil, k.unexpectedStatus(ctx, realm, "login", resp.StatusCode)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	var tokens TokenSet
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return result.AccessToken, nil
+	k.log(ctx, realm).Debug("Logged in through Keycloak")
+	return &tokens, nil
 }
 
-// ValidateToken validates the provided token and returns token information
+// ValidateToken validates the provided token and returns token information.
+// In local mode the token is verified against the realm JWKS, otherwise it is
+// checked by calling the userinfo endpoint.
 func (k *KeycloakProvider) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if realm.validator != nil {
+		return realm.validator.Validate(ctx, token)
+	}
+
 	introspectionURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/userinfo",
-		k.config.BaseURL, k.config.Realm)
+		realm.baseURL, realm.name)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", introspectionURL, nil)
 	if err != nil {
@@ -82,7 +125,7 @@ func (k *KeycloakProvider) ValidateToken(ctx context.Context, token string) (*To
 
 	resp, err := k.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, k.requestFailed(ctx, realm, "validate token", err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -95,36 +138,30 @@ func (k *KeycloakProvider) ValidateToken(ctx context.Context, token string) (*To
 		if resp.StatusCode == http.StatusUnauthorized {
 			return nil, ErrTokenInvalid
 		}
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	var userInfo struct {
-		Sub        string   `json:"sub"`
-		Username   string   `json:"preferred_username"`
-		Email      string   `json:"email"`
-		RealmRoles []string `json:"realm_access"`
+		return nil, k.unexpectedStatus(ctx, realm, "validate token", resp.StatusCode)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return &TokenInfo{
-		UserID:   userInfo.Sub,
-		Username: userInfo.Username,
-		Email:    userInfo.Email,
-		Roles:    userInfo.RealmRoles,
-	}, nil
+	return tokenInfoFromClaims(claims), nil
 }
 
 // Logout invalidates the provided token
 func (k *KeycloakProvider) Logout(ctx context.Context, token string) error {
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return err
+	}
+
 	logoutURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/logout",
-		k.config.BaseURL, k.config.Realm)
+		realm.baseURL, realm.name)
 
 	data := url.Values{}
-	data.Set("client_id", k.config.ClientID)
-	data.Set("client_secret", k.config.ClientSecret)
+	data.Set("client_id", realm.clientID)
+	data.Set("client_secret", realm.clientSecret)
 	data.Set("refresh_token", token)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", logoutURL,
@@ -137,7 +174,7 @@ func (k *KeycloakProvider) Logout(ctx context.Context, token string) error {
 
 	resp, err := k.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return k.requestFailed(ctx, realm, "logout", err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -146,35 +183,41 @@ func (k *KeycloakProvider) Logout(ctx context.Context, token string) error {
 		}
 	}(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	// Keycloak answers a successful logout with 204 No Content
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return k.unexpectedStatus(ctx, realm, "logout", resp.StatusCode)
 	}
 
 	return nil
 }
 
-// RefreshToken refreshes the provided token
-func (k *KeycloakProvider) RefreshToken(ctx context.Context, refreshToken string) (string, error) {
+// RefreshToken exchanges a refresh token for a new token set
+func (k *KeycloakProvider) RefreshToken(ctx context.Context, refreshToken string) (*TokenSet, error) {
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
-	data.Set("client_id", k.config.ClientID)
-	data.Set("client_secret", k.config.ClientSecret)
+	data.Set("client_id", realm.clientID)
+	data.Set("client_secret", realm.clientSecret)
 	data.Set("refresh_token", refreshToken)
 
 	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token",
-		k.config.BaseURL, k.config.Realm)
+		realm.baseURL, realm.name)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL,
 		strings.NewReader(data.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := k.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute request: %w", err)
+		return nil, k.requestFailed(ctx, realm, "refresh token", err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -185,35 +228,40 @@ func (k *KeycloakProvider) RefreshToken(ctx context.Context, refreshToken string
 
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusUnauthorized {
-			return "", ErrTokenExpired
+			return nil, ErrTokenExpired
 		}
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
 
-	var result struct {
-		AccessToken string `json:"access_token"`
+		// Keycloak rejects expired, revoked and malformed refresh tokens with
+		// 400 invalid_grant
+		var body oauthError
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error == "invalid_grant" {
+			k.log(ctx, realm).Debug("Keycloak rejected refresh token", logger.String("reason", body.Description))
+			return nil, ErrTokenExpired
+		}
+		return nil, k.unexpectedStatus(ctx, realm, "refresh token", resp.StatusCode)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	var tokens TokenSet
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return result.AccessToken, nil
+	return &tokens, nil
 }
 
 // GetUserInfo retrieves user information
 func (k *KeycloakProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
-	userURL := fmt.Sprintf("%s/admin/realms/%s/users/%s",
-		k.config.BaseURL, k.config.Realm, userID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", userURL, nil)
+	realm, err := k.realm(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	resp, err := k.client.Do(req)
+	userURL := fmt.Sprintf("%s/admin/realms/%s/users/%s",
+		realm.baseURL, realm.name, url.PathEscape(userID))
+
+	resp, err := k.doAdminRequest(ctx, realm, "GET", userURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -226,7 +274,7 @@ func (k *KeycloakProvider) GetUserInfo(ctx context.Context, userID string) (*Use
 		if resp.StatusCode == http.StatusNotFound {
 			return nil, ErrUserNotFound
 		}
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, k.unexpectedStatus(ctx, realm, "get user", resp.StatusCode)
 	}
 
 	var user UserInfo
@@ -237,28 +285,286 @@ func (k *KeycloakProvider) GetUserInfo(ctx context.Context, userID string) (*Use
 	return &user, nil
 }
 
+// UpdateUserInfo applies the non-empty fields of info to a user. Fields left
+// empty keep their current value, and roles are managed through AssignRole
+// and RemoveRole rather than here.
 func (k *KeycloakProvider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
-	// Implementation details...
-	return nil
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := k.getUserRepresentation(ctx, realm, userID)
+	if err != nil {
+		return err
+	}
+
+	if info.UserName != "" {
+		user["username"] = info.UserName
+	}
+	if info.Email != "" {
+		// A new address has not been verified yet
+		if current, _ := user["email"].(string); !strings.EqualFold(current, info.Email) {
+			user["emailVerified"] = false
+		}
+		user["email"] = info.Email
+	}
+
+	userURL := fmt.Sprintf("%s/admin/realms/%s/users/%s",
+		realm.baseURL, realm.name, url.PathEscape(userID))
+
+	payload, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to encode user: %w", err)
+	}
+
+	resp, err := k.doAdminRequest(ctx, realm, "PUT", userURL, payload)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	case http.StatusConflict:
+		var body struct {
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.ErrorMessage != "" {
+			return fmt.Errorf("%w: %s", ErrUserConflict, body.ErrorMessage)
+		}
+		return ErrUserConflict
+	default:
+		return k.unexpectedStatus(ctx, realm, "update user", resp.StatusCode)
+	}
 }
 
+// getUserRepresentation fetches the full Keycloak UserRepresentation of a user
+// so that updates can be sent back without dropping fields the bridge does not model
+func (k *KeycloakProvider) getUserRepresentation(ctx context.Context, realm *keycloakRealm, userID string) (map[string]interface{}, error) {
+	userURL := fmt.Sprintf("%s/admin/realms/%s/users/%s",
+		realm.baseURL, realm.name, url.PathEscape(userID))
+
+	resp, err := k.doAdminRequest(ctx, realm, "GET", userURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, k.unexpectedStatus(ctx, realm, "get user", resp.StatusCode)
+	}
+
+	var user map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return user, nil
+}
+
+// AssignRole grants the realm role with the given name to a user
 func (k *KeycloakProvider) AssignRole(ctx context.Context, userID string, role string) error {
-	// Implementation details...
-	return nil
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return err
+	}
+
+	realmRole, err := k.getRealmRole(ctx, realm, role)
+	if err != nil {
+		return err
+	}
+
+	return k.modifyRoleMappings(ctx, realm, http.MethodPost, userID, []keycloakRole{*realmRole})
 }
 
+// RemoveRole revokes the realm role with the given name from a user
 func (k *KeycloakProvider) RemoveRole(ctx context.Context, userID string, role string) error {
-	// Implementation details...
-	return nil
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return err
+	}
+
+	realmRole, err := k.getRealmRole(ctx, realm, role)
+	if err != nil {
+		return err
+	}
+
+	return k.modifyRoleMappings(ctx, realm, http.MethodDelete, userID, []keycloakRole{*realmRole})
 }
 
+// GetUserRoles returns the names of the realm roles directly mapped to a user
 func (k *KeycloakProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
-	// Implementation details...
-	return nil, nil
+	realm, err := k.realm(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mappingsURL := fmt.Sprintf("%s/admin/realms/%s/users/%s/role-mappings/realm",
+		realm.baseURL, realm.name, url.PathEscape(userID))
+
+	resp, err := k.doAdminRequest(ctx, realm, "GET", mappingsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, k.unexpectedStatus(ctx, realm, "get user roles", resp.StatusCode)
+	}
+
+	var mappings []keycloakRole
+	if err := json.NewDecoder(resp.Body).Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	roles := make([]string, 0, len(mappings))
+	for _, mapping := range mappings {
+		roles = append(roles, mapping.Name)
+	}
+
+	return roles, nil
+}
+
+// getRealmRole looks up a realm role representation by its name
+func (k *KeycloakProvider) getRealmRole(ctx context.Context, realm *keycloakRealm, name string) (*keycloakRole, error) {
+	roleURL := fmt.Sprintf("%s/admin/realms/%s/roles/%s",
+		realm.baseURL, realm.name, url.PathEscape(name))
+
+	resp, err := k.doAdminRequest(ctx, realm, "GET", roleURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrRoleNotFound
+		}
+		return nil, k.unexpectedStatus(ctx, realm, "get role", resp.StatusCode)
+	}
+
+	var role keycloakRole
+	if err := json.NewDecoder(resp.Body).Decode(&role); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &role, nil
+}
+
+// modifyRoleMappings adds (POST) or removes (DELETE) realm role mappings of a user
+func (k *KeycloakProvider) modifyRoleMappings(ctx context.Context, realm *keycloakRealm, method, userID string, roles []keycloakRole) error {
+	mappingsURL := fmt.Sprintf("%s/admin/realms/%s/users/%s/role-mappings/realm",
+		realm.baseURL, realm.name, url.PathEscape(userID))
+
+	payload, err := json.Marshal(roles)
+	if err != nil {
+		return fmt.Errorf("failed to encode role mappings: %w", err)
+	}
+
+	resp, err := k.doAdminRequest(ctx, realm, method, mappingsURL, payload)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	default:
+		return k.unexpectedStatus(ctx, realm, "modify role mappings", resp.StatusCode)
+	}
 }
 
+// doAdminRequest performs an authenticated request against the Keycloak admin REST API
+func (k *KeycloakProvider) doAdminRequest(ctx context.Context, realm *keycloakRealm, method, endpoint string, payload []byte) (*http.Response, error) {
+	resp, err := realm.adminTokens.Do(ctx, k.client, method, endpoint, payload)
+	if err != nil {
+		k.log(ctx, realm).Error("Keycloak admin request failed",
+			logger.String("method", method), logger.String("url", endpoint), logger.Err(err))
+		return nil, err
+	}
+
+	k.log(ctx, realm).Debug("Keycloak admin request",
+		logger.String("method", method), logger.String("url", endpoint), logger.Int("status", resp.StatusCode))
+	return resp, nil
+}
+
+// requestFailed logs a request to Keycloak that got no response and returns
+// its error
+func (k *KeycloakProvider) requestFailed(ctx context.Context, realm *keycloakRealm, operation string, err error) error {
+	k.log(ctx, realm).Error("Keycloak request failed", logger.String("operation", operation), logger.Err(err))
+	return fmt.Errorf("failed to execute request: %w", err)
+}
+
+// unexpectedStatus logs a Keycloak response with a status the operation does
+// not handle and returns its error
+func (k *KeycloakProvider) unexpectedStatus(ctx context.Context, realm *keycloakRealm, operation string, status int) error {
+	k.log(ctx, realm).Warn("Unexpected Keycloak response", logger.String("operation", operation), logger.Int("status", status))
+	return fmt.Errorf("unexpected status code: %d", status)
+}
+
+// log returns the logger of the request carried by ctx, scoped to the realm
+func (k *KeycloakProvider) log(ctx context.Context, realm *keycloakRealm) logger.Logger {
+	return logger.FromContext(ctx).With(logger.String("provider", "keycloak"), logger.String("realm", realm.name))
+}
+
+// HealthCheck checks every Keycloak server the provider is configured with
 func (k *KeycloakProvider) HealthCheck(ctx context.Context) error {
-	healthURL := fmt.Sprintf("%s/health", k.config.BaseURL)
+	checked := make(map[string]bool)
+	for _, realm := range k.realms() {
+		if checked[realm.baseURL] {
+			continue
+		}
+		checked[realm.baseURL] = true
+
+		if err := k.checkHealth(ctx, realm.baseURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkHealth calls the health endpoint of a Keycloak server
+func (k *KeycloakProvider) checkHealth(ctx context.Context, baseURL string) error {
+	healthURL := fmt.Sprintf("%s/health", baseURL)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
 	if err != nil {
@@ -267,6 +573,7 @@ func (k *KeycloakProvider) HealthCheck(ctx context.Context) error {
 
 	resp, err := k.client.Do(req)
 	if err != nil {
+		logger.FromContext(ctx).Warn("Keycloak health check failed", logger.String("url", healthURL), logger.Err(err))
 		return fmt.Errorf("health check failed: %w", err)
 	}
 	defer func(Body io.ReadCloser) {
@@ -277,23 +584,120 @@ func (k *KeycloakProvider) HealthCheck(ctx context.Context) error {
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
+		logger.FromContext(ctx).Warn("Keycloak health check failed", logger.String("url", healthURL), logger.Int("status", resp.StatusCode))
 		return fmt.Errorf("health check failed with status: %d", resp.StatusCode)
 	}
 
 	return nil
 }
 
-// NewKeycloakProvider creates a new KeycloakProvider instance
-func NewKeycloakProvider(cfg config.KeycloakConfig, log *logger.Logger) (IAMProvider, error) {
-	if cfg.BaseURL == "" || cfg.Realm == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+// realm returns the realm serving the tenant carried by ctx
+func (k *KeycloakProvider) realm(ctx context.Context) (*keycloakRealm, error) {
+	id := tenant.FromContext(ctx)
+	if id == "" {
+		if k.defaultRealm == nil {
+			return nil, ErrTenantRequired
+		}
+		return k.defaultRealm, nil
+	}
+
+	realm, ok := k.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, id)
+	}
+	return realm, nil
+}
+
+// realms returns the default realm, if any, and the realms of all tenants
+func (k *KeycloakProvider) realms() []*keycloakRealm {
+	realms := make([]*keycloakRealm, 0, len(k.tenants)+1)
+	if k.defaultRealm != nil {
+		realms = append(realms, k.defaultRealm)
+	}
+	for _, realm := range k.tenants {
+		realms = append(realms, realm)
+	}
+	return realms
+}
+
+// NewKeycloakProvider creates a new KeycloakProvider instance. It logs through
+// the logger of each request's context.
+func NewKeycloakProvider(cfg config.KeycloakConfig) (IAMProvider, error) {
+	hasDefault := cfg.Realm != "" || cfg.ClientID != "" || cfg.ClientSecret != ""
+	if hasDefault && (cfg.BaseURL == "" || cfg.Realm == "" || cfg.ClientID == "" || cfg.ClientSecret == "") ||
+		!hasDefault && len(cfg.Tenants) == 0 {
 		return nil, fmt.Errorf("missing required Keycloak configuration")
 	}
 
-	return &KeycloakProvider{
-		config: &cfg,
-		logger: log,
-		client: &http.Client{
-			Timeout: time.Second * 10,
-		},
-	}, nil
+	validation := strings.ToLower(cfg.TokenValidation.Mode)
+	switch validation {
+	case "", "remote", "local":
+	default:
+		return nil, fmt.Errorf("invalid Keycloak token validation mode: %s", cfg.TokenValidation.Mode)
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	provider := &KeycloakProvider{
+		config:  &cfg,
+		client:  client,
+		tenants: make(map[string]*keycloakRealm, len(cfg.Tenants)),
+	}
+
+	if hasDefault {
+		provider.defaultRealm = newKeycloakRealm(cfg.BaseURL, cfg.Realm, cfg.ClientID, cfg.ClientSecret.Value(), client)
+		if validation == "local" {
+			provider.defaultRealm.validator = newKeycloakValidator(&cfg.TokenValidation, provider.defaultRealm, cfg.TokenValidation.Issuer, client)
+		}
+	}
+
+	for id, tenantCfg := range cfg.Tenants {
+		baseURL := tenantCfg.BaseURL
+		if baseURL == "" {
+			baseURL = cfg.BaseURL
+		}
+		if baseURL == "" || tenantCfg.Realm == "" || tenantCfg.ClientID == "" || tenantCfg.ClientSecret == "" {
+			return nil, fmt.Errorf("missing required Keycloak configuration for tenant %s", id)
+		}
+
+		realm := newKeycloakRealm(baseURL, tenantCfg.Realm, tenantCfg.ClientID, tenantCfg.ClientSecret.Value(), client)
+		if validation == "local" {
+			// The issuer override only applies to the default realm
+			realm.validator = newKeycloakValidator(&cfg.TokenValidation, realm, "", client)
+		}
+		provider.tenants[strings.ToLower(id)] = realm
+	}
+
+	return provider, nil
+}
+
+// newKeycloakRealm creates the realm state for a realm and client
+func newKeycloakRealm(baseURL, name, clientID, clientSecret string, client *http.Client) *keycloakRealm {
+	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", baseURL, name)
+
+	return &keycloakRealm{
+		baseURL:      baseURL,
+		name:         name,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		adminTokens:  newAdminTokenManager(tokenURL, clientID, clientSecret, client),
+	}
+}
+
+// newKeycloakValidator creates a local JWT validator for the realm's signing
+// keys, accepting only access tokens, whose typ is Bearer. The issuer defaults
+// to the realm URL when empty.
+func newKeycloakValidator(validation *config.TokenValidationConfig, realm *keycloakRealm, issuer string, client *http.Client) *jwtValidator {
+	if issuer == "" {
+		issuer = fmt.Sprintf("%s/realms/%s", realm.baseURL, realm.name)
+	}
+
+	jwksURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/certs",
+		realm.baseURL, realm.name)
+
+	validator := newJWTValidator(validation, jwksURL, issuer, realm.clientID, client)
+	validator.tokenType = "Bearer"
+	return validator
 }
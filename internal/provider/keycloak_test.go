@@ -0,0 +1,189 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+	"github.com/zahidhasanpapon/iam-bridge/internal/tenant"
+)
+
+func TestKeycloakProviderConformance(t *testing.T) {
+	for _, mode := range []string{"remote", "local"} {
+		t.Run(mode, func(t *testing.T) {
+			providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+				server := providertest.NewKeycloakServer(t)
+				f := providertest.Seed(server)
+
+				cfg := server.Config()
+				cfg.TokenValidation.Mode = mode
+
+				p, err := provider.NewKeycloakProvider(cfg)
+				if err != nil {
+					t.Fatalf("failed to create provider: %v", err)
+				}
+
+				f.Provider = p
+				return f
+			})
+		})
+	}
+}
+
+func TestKeycloakProviderUnverifiesChangedEmail(t *testing.T) {
+	server := providertest.NewKeycloakServer(t)
+	alice := server.AddUser(providertest.User{
+		Username:      "alice",
+		Email:         "alice@example.com",
+		Password:      "alice-password",
+		EmailVerified: true,
+	})
+
+	p, err := provider.NewKeycloakProvider(server.Config())
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := p.UpdateUserInfo(ctx, alice.ID, &provider.UserInfo{Email: "Alice@example.com"}); err != nil {
+		t.Fatalf("UpdateUserInfo returned unexpected error: %v", err)
+	}
+	if user, _ := server.User(alice.ID); !user.EmailVerified {
+		t.Error("email was unverified by an update to the same address")
+	}
+
+	if err := p.UpdateUserInfo(ctx, alice.ID, &provider.UserInfo{Email: "alice@example.org"}); err != nil {
+		t.Fatalf("UpdateUserInfo returned unexpected error: %v", err)
+	}
+	if user, _ := server.User(alice.ID); user.EmailVerified {
+		t.Error("email is still verified after changing the address")
+	}
+}
+
+func TestKeycloakProviderRejectsIDTokens(t *testing.T) {
+	for _, mode := range []string{"remote", "local"} {
+		t.Run(mode, func(t *testing.T) {
+			server := providertest.NewKeycloakServer(t)
+			f := providertest.Seed(server)
+
+			cfg := server.Config()
+			cfg.TokenValidation.Mode = mode
+			p, err := provider.NewKeycloakProvider(cfg)
+			if err != nil {
+				t.Fatalf("failed to create provider: %v", err)
+			}
+			ctx := context.Background()
+
+			tokens, err := p.Login(ctx, f.Username, f.Password)
+			if err != nil {
+				t.Fatalf("Login returned unexpected error: %v", err)
+			}
+			if tokens.IDToken == "" {
+				t.Fatal("Login returned no ID token")
+			}
+
+			if _, err := p.ValidateToken(ctx, tokens.IDToken); !errors.Is(err, provider.ErrTokenInvalid) {
+				t.Errorf("ValidateToken of an ID token returned %v, want %v", err, provider.ErrTokenInvalid)
+			}
+		})
+	}
+}
+
+func TestKeycloakProviderTenants(t *testing.T) {
+	for _, mode := range []string{"remote", "local"} {
+		t.Run(mode, func(t *testing.T) {
+			t.Run("Conformance", func(t *testing.T) {
+				providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+					p, alice := newTenantKeycloakProvider(t, mode)
+					return &providertest.Fixture{
+						Provider: p,
+						UserID:   alice.ID,
+						Username: alice.Username,
+						Password: alice.Password,
+						Role:     "users:admin",
+						Context:  tenant.NewContext(context.Background(), "acme"),
+					}
+				})
+			})
+
+			t.Run("RejectsOtherTenantTokens", func(t *testing.T) {
+				p, alice := newTenantKeycloakProvider(t, mode)
+				acmeCtx := tenant.NewContext(context.Background(), "acme")
+				globexCtx := tenant.NewContext(context.Background(), "globex")
+
+				tokens, err := p.Login(acmeCtx, alice.Username, alice.Password)
+				if err != nil {
+					t.Fatalf("Login returned unexpected error: %v", err)
+				}
+
+				if _, err := p.ValidateToken(globexCtx, tokens.AccessToken); !errors.Is(err, provider.ErrTokenInvalid) {
+					t.Errorf("ValidateToken for another tenant returned %v, want ErrTokenInvalid", err)
+				}
+				if _, err := p.RefreshToken(globexCtx, tokens.RefreshToken); !errors.Is(err, provider.ErrTokenExpired) {
+					t.Errorf("RefreshToken for another tenant returned %v, want ErrTokenExpired", err)
+				}
+			})
+
+			t.Run("RequiresKnownTenant", func(t *testing.T) {
+				p, alice := newTenantKeycloakProvider(t, mode)
+
+				if _, err := p.Login(context.Background(), alice.Username, alice.Password); !errors.Is(err, provider.ErrTenantRequired) {
+					t.Errorf("Login without a tenant returned %v, want ErrTenantRequired", err)
+				}
+
+				unknownCtx := tenant.NewContext(context.Background(), "initech")
+				if _, err := p.Login(unknownCtx, alice.Username, alice.Password); !errors.Is(err, provider.ErrTenantNotFound) {
+					t.Errorf("Login for an unknown tenant returned %v, want ErrTenantNotFound", err)
+				}
+			})
+		})
+	}
+}
+
+// newTenantKeycloakProvider creates a provider with the tenants "acme" and
+// "globex", each on its own fake Keycloak with the same user alice
+func newTenantKeycloakProvider(t *testing.T, mode string) (provider.IAMProvider, *providertest.User) {
+	t.Helper()
+
+	acme := providertest.NewKeycloakServer(t)
+	acme.AddRole("users:admin")
+	alice := acme.AddUser(providertest.User{
+		Username: "alice",
+		Password: "alice-password",
+	})
+
+	globex := providertest.NewKeycloakServer(t)
+	globex.Realm = "globex"
+	globex.AddUser(providertest.User{
+		ID:       alice.ID,
+		Username: alice.Username,
+		Password: alice.Password,
+	})
+
+	p, err := provider.NewKeycloakProvider(config.KeycloakConfig{
+		TokenValidation: config.TokenValidationConfig{Mode: mode},
+		Tenants: map[string]config.KeycloakTenantConfig{
+			"acme":   tenantConfig(acme),
+			"globex": tenantConfig(globex),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	return p, alice
+}
+
+// tenantConfig returns a tenant configuration pointing at a fake Keycloak
+func tenantConfig(server *providertest.KeycloakServer) config.KeycloakTenantConfig {
+	cfg := server.Config()
+	return config.KeycloakTenantConfig{
+		BaseURL:      cfg.BaseURL,
+		Realm:        cfg.Realm,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+	}
+}
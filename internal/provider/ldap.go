@@ -0,0 +1,452 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// LDAPProvider implements IAMProvider on top of an LDAP directory such as
+// OpenLDAP or Active Directory. Users log in with search-then-bind, roles come
+// from group membership, and the bridge issues its own session tokens.
+type LDAPProvider struct {
+	config   *config.LDAPConfig
+	pool     *ldapPool
+	sessions *sessionIssuer
+}
+
+// Login finds the user's entry with the service account, binds as the user to
+// check the password and issues a session token set
+func (l *LDAPProvider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var subject *sessionSubject
+	err := l.pool.withConn(ctx, func(conn *ldap.Conn) error {
+		entry, err := l.findUser(conn, l.config.Attributes.Username, username)
+		if err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				return ErrInvalidCredentials
+			}
+			return err
+		}
+
+		bindErr := conn.Bind(entry.DN, password)
+
+		// Return the connection to the service account whatever the outcome
+		if err := conn.Bind(l.config.BindDN, l.config.BindPassword.Value()); err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("failed to rebind service account: %w", err)
+		}
+
+		if bindErr != nil {
+			if ldap.IsErrorWithCode(bindErr, ldap.LDAPResultInvalidCredentials) {
+				return ErrInvalidCredentials
+			}
+			return fmt.Errorf("failed to bind user: %w", bindErr)
+		}
+
+		subject, err = l.subject(conn, entry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return l.sessions.Issue(subject)
+}
+
+// Logout revokes the provided session token
+func (l *LDAPProvider) Logout(ctx context.Context, token string) error {
+	return l.sessions.Revoke(token)
+}
+
+// ValidateToken verifies a session access token issued by the bridge
+func (l *LDAPProvider) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	claims, err := l.sessions.Validate(token, sessionTokenUseAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenInfoFromClaims(claims), nil
+}
+
+// RefreshToken issues a new session token set for a valid refresh token. The
+// user and their roles are looked up again, and the old refresh token is revoked.
+func (l *LDAPProvider) RefreshToken(ctx context.Context, refreshToken string) (*TokenSet, error) {
+	claims, err := l.sessions.Validate(refreshToken, sessionTokenUseRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, _ := claims["sub"].(string)
+
+	var subject *sessionSubject
+	err = l.pool.withConn(ctx, func(conn *ldap.Conn) error {
+		entry, err := l.findUser(conn, l.config.Attributes.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		subject, err = l.subject(conn, entry)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrTokenInvalid
+		}
+		return nil, err
+	}
+
+	if err := l.sessions.Revoke(refreshToken); err != nil {
+		return nil, err
+	}
+
+	return l.sessions.Issue(subject)
+}
+
+// GetUserInfo retrieves user information using the configured attribute mapping
+func (l *LDAPProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	var user *UserInfo
+	err := l.pool.withConn(ctx, func(conn *ldap.Conn) error {
+		entry, err := l.findUser(conn, l.config.Attributes.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		subject, err := l.subject(conn, entry)
+		if err != nil {
+			return err
+		}
+
+		user = &UserInfo{
+			ID:       subject.ID,
+			UserName: subject.Username,
+			Email:    subject.Email,
+			Roles:    subject.Roles,
+		}
+		return nil
+	})
+
+	return user, err
+}
+
+// UpdateUserInfo replaces the user's email when set. Renaming entries is not
+// supported, so a username change is reported as unsupported.
+func (l *LDAPProvider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
+	return l.pool.withConn(ctx, func(conn *ldap.Conn) error {
+		entry, err := l.findUser(conn, l.config.Attributes.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		if info.UserName != "" && info.UserName != entry.GetAttributeValue(l.config.Attributes.Username) {
+			return &UnsupportedOperationError{Provider: "ldap", Operation: "changing the username"}
+		}
+
+		if info.Email == "" {
+			return nil
+		}
+
+		modify := ldap.NewModifyRequest(entry.DN, nil)
+		modify.Replace(l.config.Attributes.Email, []string{info.Email})
+
+		if err := conn.Modify(modify); err != nil {
+			if ldap.IsErrorAnyOf(err, ldap.LDAPResultConstraintViolation, ldap.LDAPResultEntryAlreadyExists) {
+				return fmt.Errorf("%w: %v", ErrUserConflict, err)
+			}
+			return fmt.Errorf("failed to modify user: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// AssignRole adds the user to the group named role
+func (l *LDAPProvider) AssignRole(ctx context.Context, userID string, role string) error {
+	return l.modifyGroupMembership(ctx, userID, role, true)
+}
+
+// RemoveRole removes the user from the group named role
+func (l *LDAPProvider) RemoveRole(ctx context.Context, userID string, role string) error {
+	return l.modifyGroupMembership(ctx, userID, role, false)
+}
+
+// GetUserRoles returns the names of the groups the user belongs to
+func (l *LDAPProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	var roles []string
+	err := l.pool.withConn(ctx, func(conn *ldap.Conn) error {
+		entry, err := l.findUser(conn, l.config.Attributes.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		roles, err = l.userRoles(conn, entry)
+		return err
+	})
+
+	return roles, err
+}
+
+// HealthCheck reads the root DSE with a pooled connection
+func (l *LDAPProvider) HealthCheck(ctx context.Context) error {
+	err := l.pool.withConn(ctx, func(conn *ldap.Conn) error {
+		_, err := conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject,
+			ldap.NeverDerefAliases, 1, 0, false, "(objectClass=*)", []string{"1.1"}, nil))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	return nil
+}
+
+// Close closes the idle pooled connections
+func (l *LDAPProvider) Close() error {
+	l.pool.Close()
+	return nil
+}
+
+// modifyGroupMembership adds or removes the user's DN in the group's member attribute
+func (l *LDAPProvider) modifyGroupMembership(ctx context.Context, userID, role string, add bool) error {
+	if l.config.GroupBaseDN == "" {
+		return &UnsupportedOperationError{Provider: "ldap", Operation: "role changes without group_base_dn"}
+	}
+
+	return l.pool.withConn(ctx, func(conn *ldap.Conn) error {
+		user, err := l.findUser(conn, l.config.Attributes.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		groupDN, err := l.findGroup(conn, role)
+		if err != nil {
+			return err
+		}
+
+		modify := ldap.NewModifyRequest(groupDN, nil)
+		if add {
+			modify.Add(l.config.Attributes.GroupMember, []string{user.DN})
+		} else {
+			modify.Delete(l.config.Attributes.GroupMember, []string{user.DN})
+		}
+
+		if err := conn.Modify(modify); err != nil {
+			// Adding an existing member or removing a non-member is already done
+			if ldap.IsErrorAnyOf(err, ldap.LDAPResultAttributeOrValueExists, ldap.LDAPResultNoSuchAttribute) {
+				return nil
+			}
+			return fmt.Errorf("failed to modify group: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// findUser searches for the single user entry whose attribute equals value
+func (l *LDAPProvider) findUser(conn *ldap.Conn, attribute, value string) (*ldap.Entry, error) {
+	filter := fmt.Sprintf("(&%s(%s=%s))", l.config.UserFilter, attribute, ldap.EscapeFilter(value))
+	attributes := []string{
+		l.config.Attributes.ID,
+		l.config.Attributes.Username,
+		l.config.Attributes.Email,
+		l.config.Attributes.MemberOf,
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(l.config.UserBaseDN, ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 2, 0, false, filter, attributes, nil))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("multiple LDAP entries match %s=%s", attribute, value)
+		}
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to search user: %w", err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("multiple LDAP entries match %s=%s", attribute, value)
+	}
+}
+
+// findGroup returns the DN of the group with the given name
+func (l *LDAPProvider) findGroup(conn *ldap.Conn, name string) (string, error) {
+	filter := fmt.Sprintf("(&%s(%s=%s))", l.config.GroupFilter,
+		l.config.Attributes.GroupName, ldap.EscapeFilter(name))
+
+	result, err := conn.Search(ldap.NewSearchRequest(l.config.GroupBaseDN, ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 1, 0, false, filter, []string{"1.1"}, nil))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return "", ErrRoleNotFound
+		}
+		return "", fmt.Errorf("failed to search group: %w", err)
+	}
+
+	if result == nil || len(result.Entries) == 0 {
+		return "", ErrRoleNotFound
+	}
+
+	return result.Entries[0].DN, nil
+}
+
+// userRoles returns the names of the user's groups, from a group search when
+// a group base DN is configured and from memberOf otherwise
+func (l *LDAPProvider) userRoles(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	roles := []string{}
+
+	if l.config.GroupBaseDN == "" {
+		for _, groupDN := range entry.GetAttributeValues(l.config.Attributes.MemberOf) {
+			if name := groupNameFromDN(groupDN); name != "" {
+				roles = append(roles, name)
+			}
+		}
+		return roles, nil
+	}
+
+	filter := fmt.Sprintf("(&%s(%s=%s))", l.config.GroupFilter,
+		l.config.Attributes.GroupMember, ldap.EscapeFilter(entry.DN))
+
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(l.config.GroupBaseDN, ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, filter, []string{l.config.Attributes.GroupName}, nil), 500)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search groups: %w", err)
+	}
+
+	for _, group := range result.Entries {
+		if name := group.GetAttributeValue(l.config.Attributes.GroupName); name != "" {
+			roles = append(roles, name)
+		}
+	}
+
+	return roles, nil
+}
+
+// subject builds the session subject for a user entry
+func (l *LDAPProvider) subject(conn *ldap.Conn, entry *ldap.Entry) (*sessionSubject, error) {
+	roles, err := l.userRoles(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionSubject{
+		ID:       entry.GetAttributeValue(l.config.Attributes.ID),
+		Username: entry.GetAttributeValue(l.config.Attributes.Username),
+		Email:    entry.GetAttributeValue(l.config.Attributes.Email),
+		Roles:    roles,
+	}, nil
+}
+
+// groupNameFromDN returns the value of the first RDN of a group DN, such as
+// "admins" for "cn=admins,ou=groups,dc=example,dc=com"
+func groupNameFromDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return ""
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
+
+// applyLDAPDefaults fills unset LDAP settings with OpenLDAP-style defaults
+func applyLDAPDefaults(cfg *config.LDAPConfig) {
+	defaults := []struct {
+		value    *string
+		fallback string
+	}{
+		{&cfg.UserFilter, "(objectClass=person)"},
+		{&cfg.GroupFilter, "(objectClass=groupOfNames)"},
+		{&cfg.Attributes.Username, "uid"},
+		{&cfg.Attributes.Email, "mail"},
+		{&cfg.Attributes.MemberOf, "memberOf"},
+		{&cfg.Attributes.GroupName, "cn"},
+		{&cfg.Attributes.GroupMember, "member"},
+	}
+	for _, d := range defaults {
+		if *d.value == "" {
+			*d.value = d.fallback
+		}
+	}
+
+	if cfg.Attributes.ID == "" {
+		cfg.Attributes.ID = cfg.Attributes.Username
+	}
+	if cfg.Pool.Size <= 0 {
+		cfg.Pool.Size = 10
+	}
+	if cfg.Pool.DialTimeout <= 0 {
+		cfg.Pool.DialTimeout = 5 * time.Second
+	}
+}
+
+// NewLDAPProvider creates a new LDAPProvider instance. Connections are dialed
+// lazily, so the bridge can start while the directory is unreachable.
+func NewLDAPProvider(cfg config.LDAPConfig) (IAMProvider, error) {
+	if cfg.URL == "" || cfg.BindDN == "" || cfg.UserBaseDN == "" {
+		return nil, fmt.Errorf("missing required LDAP configuration")
+	}
+
+	serverURL, err := url.Parse(cfg.URL)
+	if err != nil || (serverURL.Scheme != "ldap" && serverURL.Scheme != "ldaps") {
+		return nil, fmt.Errorf("invalid LDAP URL: %s", cfg.URL)
+	}
+	if cfg.StartTLS && serverURL.Scheme == "ldaps" {
+		return nil, fmt.Errorf("start_tls cannot be combined with an ldaps:// URL")
+	}
+
+	applyLDAPDefaults(&cfg)
+
+	sessions, err := newSessionIssuer(&cfg.Session, "iam-bridge/ldap")
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverURL.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec // explicit opt-in for test directories
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	dial := func() (*ldap.Conn, error) {
+		conn, err := ldap.DialURL(cfg.URL,
+			ldap.DialWithDialer(&net.Dialer{Timeout: cfg.Pool.DialTimeout}),
+			ldap.DialWithTLSConfig(tlsConfig))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+		}
+
+		if cfg.StartTLS {
+			if err := conn.StartTLS(tlsConfig); err != nil {
+				_ = conn.Close()
+				return nil, fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword.Value()); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to bind service account: %w", err)
+		}
+
+		return conn, nil
+	}
+
+	return &LDAPProvider{
+		config:   &cfg,
+		pool:     newLDAPPool(cfg.Pool.Size, dial),
+		sessions: sessions,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapPool keeps a bounded set of connections bound as the service account
+type ldapPool struct {
+	dial func() (*ldap.Conn, error)
+	// idle holds connections ready for reuse
+	idle chan *ldap.Conn
+	// slots holds one token per open connection, idle or in use
+	slots chan struct{}
+}
+
+// newLDAPPool creates a pool of at most size connections
+func newLDAPPool(size int, dial func() (*ldap.Conn, error)) *ldapPool {
+	return &ldapPool{
+		dial:  dial,
+		idle:  make(chan *ldap.Conn, size),
+		slots: make(chan struct{}, size),
+	}
+}
+
+// Get returns an idle connection, dials a new one while the pool has room, or
+// waits for a connection to be returned
+func (p *ldapPool) Get(ctx context.Context) (*ldap.Conn, error) {
+	for {
+		select {
+		case conn := <-p.idle:
+			if conn.IsClosing() {
+				p.discard(conn)
+				continue
+			}
+			return conn, nil
+		default:
+		}
+
+		select {
+		case conn := <-p.idle:
+			if conn.IsClosing() {
+				p.discard(conn)
+				continue
+			}
+			return conn, nil
+		case p.slots <- struct{}{}:
+			conn, err := p.dial()
+			if err != nil {
+				<-p.slots
+				return nil, err
+			}
+			return conn, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Put returns a connection to the pool. Connections that failed with a
+// network error, or are already closing, are discarded.
+func (p *ldapPool) Put(conn *ldap.Conn, err error) {
+	if conn.IsClosing() || ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		p.discard(conn)
+		return
+	}
+	p.idle <- conn
+}
+
+// Close closes all idle connections
+func (p *ldapPool) Close() {
+	for {
+		select {
+		case conn := <-p.idle:
+			p.discard(conn)
+		default:
+			return
+		}
+	}
+}
+
+// discard closes a connection and frees its slot
+func (p *ldapPool) discard(conn *ldap.Conn) {
+	_ = conn.Close()
+	<-p.slots
+}
+
+// withConn runs fn with a pooled connection and returns the connection afterwards
+func (p *ldapPool) withConn(ctx context.Context, fn func(conn *ldap.Conn) error) error {
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get LDAP connection: %w", err)
+	}
+
+	err = fn(conn)
+	p.Put(conn, err)
+	return err
+}
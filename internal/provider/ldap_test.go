@@ -0,0 +1,38 @@
+package provider_test
+
+import (
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+)
+
+func TestLDAPProviderConformance(t *testing.T) {
+	// Roles come from a group search, or from memberOf without a group base DN
+	for _, mode := range []string{"groups", "memberOf"} {
+		t.Run(mode, func(t *testing.T) {
+			providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+				server := providertest.NewLDAPServer(t)
+				f := providertest.Seed(server)
+
+				cfg := server.Config()
+				if mode == "memberOf" {
+					cfg.GroupBaseDN = ""
+				}
+				cfg.Pool.Size = 2
+				cfg.Session = config.SessionTokenConfig{
+					SigningKey: "providertest-signing-key-0123456789",
+				}
+
+				p, err := provider.NewLDAPProvider(cfg)
+				if err != nil {
+					t.Fatalf("failed to create provider: %v", err)
+				}
+
+				f.Provider = p
+				return f
+			})
+		})
+	}
+}
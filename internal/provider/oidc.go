@@ -0,0 +1,403 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// oidcDiscovery is the subset of the OpenID Provider Metadata used by the bridge
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oauthError is the error response body defined by RFC 6749 section 5.2
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// OIDCProvider implements IAMProvider for any OpenID Connect provider using the
+// endpoints advertised in its discovery document. Token operations are
+// supported; user and role management are not part of OIDC.
+type OIDCProvider struct {
+	config *config.OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	validator *jwtValidator
+}
+
+// Login authenticates a user with the resource owner password grant
+func (o *OIDCProvider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	data := url.Values{}
+	data.Set("grant_type", "password")
+	data.Set("username", username)
+	data.Set("password", password)
+	if len(o.config.Scopes) > 0 {
+		data.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+
+	return o.requestToken(ctx, data, ErrInvalidCredentials)
+}
+
+// RefreshToken exchanges a refresh token for a new token set
+func (o *OIDCProvider) RefreshToken(ctx context.Context, refreshToken string) (*TokenSet, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+
+	return o.requestToken(ctx, data, ErrTokenExpired)
+}
+
+// ValidateToken validates the provided token and returns token information.
+// In local mode the token is verified against the provider's JWKS, otherwise
+// the introspection endpoint is used when advertised, and userinfo when not.
+func (o *OIDCProvider) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(o.config.TokenValidation.Mode) == "local" {
+		return o.localValidator(discovery).Validate(ctx, token)
+	}
+
+	if discovery.IntrospectionEndpoint != "" {
+		return o.introspect(ctx, discovery.IntrospectionEndpoint, token)
+	}
+
+	if discovery.UserinfoEndpoint == "" {
+		return nil, &UnsupportedOperationError{Provider: "oidc", Operation: "remote token validation"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, ErrTokenInvalid
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return tokenInfoFromClaims(claims), nil
+}
+
+// Logout revokes the provided refresh token through the revocation endpoint.
+// Providers that do not advertise one cannot end a session without the browser,
+// so logout is unsupported for them.
+func (o *OIDCProvider) Logout(ctx context.Context, token string) error {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	endpoint := discovery.RevocationEndpoint
+	if endpoint == "" {
+		return &UnsupportedOperationError{Provider: "oidc", Operation: "logout"}
+	}
+
+	data := url.Values{}
+	data.Set("token", token)
+	data.Set("token_type_hint", "refresh_token")
+
+	resp, err := o.postForm(ctx, endpoint, data)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetUserInfo is not supported by generic OIDC providers
+func (o *OIDCProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	return nil, &UnsupportedOperationError{Provider: "oidc", Operation: "GetUserInfo"}
+}
+
+// UpdateUserInfo is not supported by generic OIDC providers
+func (o *OIDCProvider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
+	return &UnsupportedOperationError{Provider: "oidc", Operation: "UpdateUserInfo"}
+}
+
+// AssignRole is not supported by generic OIDC providers
+func (o *OIDCProvider) AssignRole(ctx context.Context, userID string, role string) error {
+	return &UnsupportedOperationError{Provider: "oidc", Operation: "AssignRole"}
+}
+
+// RemoveRole is not supported by generic OIDC providers
+func (o *OIDCProvider) RemoveRole(ctx context.Context, userID string, role string) error {
+	return &UnsupportedOperationError{Provider: "oidc", Operation: "RemoveRole"}
+}
+
+// GetUserRoles is not supported by generic OIDC providers
+func (o *OIDCProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	return nil, &UnsupportedOperationError{Provider: "oidc", Operation: "GetUserRoles"}
+}
+
+// HealthCheck verifies that the discovery document can be fetched
+func (o *OIDCProvider) HealthCheck(ctx context.Context) error {
+	if _, err := o.fetchDiscovery(ctx); err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	return nil
+}
+
+// requestToken calls the token endpoint and maps an invalid_grant error, or a
+// 401 response, to grantErr
+func (o *OIDCProvider) requestToken(ctx context.Context, data url.Values, grantErr error) (*TokenSet, error) {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.postForm(ctx, discovery.TokenEndpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, grantErr
+		}
+
+		var body oauthError
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error == "invalid_grant" {
+			return nil, grantErr
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var tokens TokenSet
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &tokens, nil
+}
+
+// introspect validates a token with the RFC 7662 introspection endpoint
+func (o *OIDCProvider) introspect(ctx context.Context, endpoint, token string) (*TokenInfo, error) {
+	data := url.Values{}
+	data.Set("token", token)
+	data.Set("token_type_hint", "access_token")
+
+	resp, err := o.postForm(ctx, endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrTokenInvalid
+	}
+
+	return tokenInfoFromClaims(claims), nil
+}
+
+// postForm sends a form-encoded request authenticated with the client
+// credentials, or the bare client_id for public clients
+func (o *OIDCProvider) postForm(ctx context.Context, endpoint string, data url.Values) (*http.Response, error) {
+	basicAuth := o.config.ClientSecret != "" && o.config.TokenEndpointAuthMethod != "client_secret_post"
+	if !basicAuth {
+		data.Set("client_id", o.config.ClientID)
+		if o.config.ClientSecret != "" {
+			data.Set("client_secret", o.config.ClientSecret.Value())
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint,
+		strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicAuth {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret.Value()))
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	return resp, nil
+}
+
+// discover returns the cached discovery document, fetching it on first use
+func (o *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	discovery := o.discovery
+	o.mu.Unlock()
+
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	return o.fetchDiscovery(ctx)
+}
+
+// fetchDiscovery downloads the discovery document and caches it
+func (o *OIDCProvider) fetchDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	discoveryURL := strings.TrimSuffix(o.config.Issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery failed with status: %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+
+	// The issuer must be the one the document was fetched for, or endpoints
+	// and tokens of another issuer could be trusted. A trailing slash is
+	// ignored, as configurations often drop it.
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(o.config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery document issuer %q does not match the configured issuer %q",
+			discovery.Issuer, o.config.Issuer)
+	}
+	if discovery.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document has no token_endpoint")
+	}
+	if strings.ToLower(o.config.TokenValidation.Mode) == "local" && discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document has no jwks_uri, which local token validation requires")
+	}
+
+	o.mu.Lock()
+	o.discovery = &discovery
+	o.mu.Unlock()
+
+	return &discovery, nil
+}
+
+// localValidator returns the JWKS validator, creating it from the discovered jwks_uri on first use
+func (o *OIDCProvider) localValidator(discovery *oidcDiscovery) *jwtValidator {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.validator == nil {
+		issuer := o.config.TokenValidation.Issuer
+		if issuer == "" {
+			issuer = discovery.Issuer
+		}
+		o.validator = newJWTValidator(&o.config.TokenValidation, discovery.JWKSURI, issuer, o.config.ClientID, o.client)
+	}
+
+	return o.validator
+}
+
+// NewOIDCProvider creates a new OIDCProvider instance. The discovery document
+// is fetched lazily so the bridge can start while the provider is unreachable.
+func NewOIDCProvider(cfg config.OIDCConfig) (IAMProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("missing required OIDC configuration")
+	}
+
+	switch strings.ToLower(cfg.TokenValidation.Mode) {
+	case "", "remote", "local":
+	default:
+		return nil, fmt.Errorf("invalid OIDC token validation mode: %s", cfg.TokenValidation.Mode)
+	}
+
+	switch cfg.TokenEndpointAuthMethod {
+	case "", "client_secret_basic", "client_secret_post":
+	default:
+		return nil, fmt.Errorf("invalid OIDC token endpoint auth method: %s", cfg.TokenEndpointAuthMethod)
+	}
+
+	return newOIDCProvider(cfg, &http.Client{
+		Timeout: time.Second * 10,
+	}), nil
+}
+
+// newOIDCProvider creates an OIDCProvider without validating the configuration,
+// for providers that build on OIDC for their token operations
+func newOIDCProvider(cfg config.OIDCConfig, client *http.Client) *OIDCProvider {
+	return &OIDCProvider{
+		config: &cfg,
+		client: client,
+	}
+}
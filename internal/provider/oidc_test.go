@@ -0,0 +1,148 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+)
+
+func TestOIDCProviderConformance(t *testing.T) {
+	// Remote validation uses introspection when it is advertised, and
+	// userinfo when it is not
+	for _, validation := range []string{"local", "introspection", "userinfo"} {
+		t.Run(validation, func(t *testing.T) {
+			providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+				server := providertest.NewOIDCServer(t)
+				server.DisableIntrospection = validation == "userinfo"
+				f := providertest.Seed(server)
+
+				cfg := server.Config()
+				cfg.TokenValidation.Mode = "remote"
+				if validation == "local" {
+					cfg.TokenValidation.Mode = "local"
+				}
+
+				p, err := provider.NewOIDCProvider(cfg)
+				if err != nil {
+					t.Fatalf("failed to create provider: %v", err)
+				}
+
+				f.Provider = p
+				return f
+			})
+		})
+	}
+}
+
+func TestOIDCProviderChecksDiscovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		issuer  func(serverURL string) string
+		jwksURI string
+		wantErr string
+	}{
+		{
+			name:    "Valid",
+			mode:    "local",
+			issuer:  func(serverURL string) string { return serverURL + "/" },
+			jwksURI: "/jwks",
+		},
+		{
+			name:    "IssuerMismatch",
+			mode:    "remote",
+			issuer:  func(string) string { return "https://attacker.example.com" },
+			wantErr: "does not match the configured issuer",
+		},
+		{
+			name:    "LocalWithoutJWKS",
+			mode:    "local",
+			issuer:  func(serverURL string) string { return serverURL },
+			wantErr: "no jwks_uri",
+		},
+		{
+			name:   "RemoteWithoutJWKS",
+			mode:   "remote",
+			issuer: func(serverURL string) string { return serverURL },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				discovery := map[string]string{
+					"issuer":         tt.issuer(server.URL),
+					"token_endpoint": server.URL + "/token",
+				}
+				if tt.jwksURI != "" {
+					discovery["jwks_uri"] = server.URL + tt.jwksURI
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(discovery)
+			}))
+			t.Cleanup(server.Close)
+
+			p, err := provider.NewOIDCProvider(config.OIDCConfig{
+				Issuer:          server.URL,
+				ClientID:        "iam-bridge",
+				TokenValidation: config.TokenValidationConfig{Mode: tt.mode},
+			})
+			if err != nil {
+				t.Fatalf("failed to create provider: %v", err)
+			}
+
+			err = p.HealthCheck(context.Background())
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("HealthCheck returned unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("HealthCheck returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderLogoutRequiresRevocation(t *testing.T) {
+	endSessionCalled := false
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			endSessionCalled = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":               server.URL,
+			"token_endpoint":       server.URL + "/token",
+			"end_session_endpoint": server.URL + "/logout",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	p, err := provider.NewOIDCProvider(config.OIDCConfig{
+		Issuer:          server.URL,
+		ClientID:        "iam-bridge",
+		TokenValidation: config.TokenValidationConfig{Mode: "remote"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	err = p.Logout(context.Background(), "refresh-token")
+	if !errors.Is(err, provider.ErrUnsupportedOperation) {
+		t.Errorf("Logout returned %v, want %v", err, provider.ErrUnsupportedOperation)
+	}
+	if endSessionCalled {
+		t.Error("Logout called the end session endpoint")
+	}
+}
@@ -0,0 +1,424 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// oktaUser is the subset of an Okta user object used by the bridge
+type oktaUser struct {
+	ID      string `json:"id"`
+	Profile struct {
+		Login string `json:"login"`
+		Email string `json:"email"`
+	} `json:"profile"`
+}
+
+// oktaGroup is the subset of an Okta group object used by the bridge
+type oktaGroup struct {
+	ID      string `json:"id"`
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+}
+
+// oktaError is the error body returned by the Okta Management API
+type oktaError struct {
+	ErrorCode    string `json:"errorCode"`
+	ErrorSummary string `json:"errorSummary"`
+	ErrorCauses  []struct {
+		ErrorSummary string `json:"errorSummary"`
+	} `json:"errorCauses"`
+}
+
+// OktaProvider implements IAMProvider on top of Okta. Token operations and the
+// health check use the authorization server's OAuth endpoints through the
+// embedded OIDCProvider, and users and roles use the Management API, with Okta
+// groups standing in for roles.
+type OktaProvider struct {
+	*OIDCProvider
+
+	config *config.OktaConfig
+	client *http.Client
+	// managementTokens is set when the Management API is accessed with a
+	// private key instead of an SSWS API token
+	managementTokens *adminTokenManager
+}
+
+// GetUserInfo retrieves user information
+func (o *OktaProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	resp, err := o.doManagementRequest(ctx, "GET", "/api/v1/users/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var user oktaUser
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &UserInfo{
+		ID:       user.ID,
+		UserName: user.Profile.Login,
+		Email:    user.Profile.Email,
+	}, nil
+}
+
+// UpdateUserInfo applies the non-empty fields of info to the user's profile.
+// Okta's POST update is partial, so omitted fields keep their current value.
+func (o *OktaProvider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
+	profile := map[string]string{}
+	if info.UserName != "" {
+		profile["login"] = info.UserName
+	}
+	if info.Email != "" {
+		profile["email"] = info.Email
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"profile": profile})
+	if err != nil {
+		return fmt.Errorf("failed to encode user: %w", err)
+	}
+
+	resp, err := o.doManagementRequest(ctx, "POST", "/api/v1/users/"+url.PathEscape(userID), payload)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	case http.StatusConflict, http.StatusBadRequest:
+		var body oktaError
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+			for _, cause := range body.ErrorCauses {
+				if strings.Contains(cause.ErrorSummary, "already exists") {
+					return fmt.Errorf("%w: %s", ErrUserConflict, cause.ErrorSummary)
+				}
+			}
+		}
+		if resp.StatusCode == http.StatusConflict {
+			return ErrUserConflict
+		}
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// AssignRole adds the user to the Okta group named role
+func (o *OktaProvider) AssignRole(ctx context.Context, userID string, role string) error {
+	return o.modifyGroupMembership(ctx, http.MethodPut, userID, role)
+}
+
+// RemoveRole removes the user from the Okta group named role
+func (o *OktaProvider) RemoveRole(ctx context.Context, userID string, role string) error {
+	return o.modifyGroupMembership(ctx, http.MethodDelete, userID, role)
+}
+
+// GetUserRoles returns the names of the Okta groups the user belongs to
+func (o *OktaProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	var roles []string
+
+	endpoint := "/api/v1/users/" + url.PathEscape(userID) + "/groups"
+	for endpoint != "" {
+		resp, err := o.doManagementRequest(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		groups, next, err := decodeOktaGroups(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groups {
+			roles = append(roles, group.Profile.Name)
+		}
+		endpoint = next
+	}
+
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return roles, nil
+}
+
+// modifyGroupMembership adds (PUT) or removes (DELETE) a user from the group named role
+func (o *OktaProvider) modifyGroupMembership(ctx context.Context, method, userID, role string) error {
+	group, err := o.findGroup(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("/api/v1/groups/%s/users/%s",
+		url.PathEscape(group.ID), url.PathEscape(userID))
+
+	resp, err := o.doManagementRequest(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// findGroup looks up a group by its exact name
+func (o *OktaProvider) findGroup(ctx context.Context, name string) (*oktaGroup, error) {
+	endpoint := "/api/v1/groups?q=" + url.QueryEscape(name)
+	for endpoint != "" {
+		resp, err := o.doManagementRequest(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		groups, next, err := decodeOktaGroups(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		// q is a prefix search, so only an exact name match counts
+		for i := range groups {
+			if groups[i].Profile.Name == name {
+				return &groups[i], nil
+			}
+		}
+		endpoint = next
+	}
+
+	return nil, ErrRoleNotFound
+}
+
+// decodeOktaGroups reads a page of groups and returns the next page link, if any
+func decodeOktaGroups(resp *http.Response) ([]oktaGroup, string, error) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			_ = fmt.Errorf("failed to close response body: %w", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, "", ErrUserNotFound
+		}
+		return nil, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var groups []oktaGroup
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		return nil, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return groups, nextLink(resp.Header), nil
+}
+
+// nextLink returns the rel="next" target of a paginated response's Link headers
+func nextLink(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			if len(parts) < 2 {
+				continue
+			}
+			for _, param := range parts[1:] {
+				if strings.TrimSpace(param) == `rel="next"` {
+					return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// doManagementRequest performs an authenticated Management API request. The
+// endpoint is either a path relative to the org URL or an absolute pagination
+// link returned by Okta. With OAuth access, a 401 response invalidates the
+// cached token and the request is retried once.
+func (o *OktaProvider) doManagementRequest(ctx context.Context, method, endpoint string, payload []byte) (*http.Response, error) {
+	orgURL := strings.TrimSuffix(o.config.OrgURL, "/")
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = orgURL + endpoint
+	} else if !strings.HasPrefix(endpoint, orgURL+"/") {
+		// Never send management credentials outside the org
+		return nil, fmt.Errorf("refusing management request outside the Okta org: %s", endpoint)
+	}
+
+	for attempt := 0; ; attempt++ {
+		authorization := "SSWS " + o.config.Management.APIToken.Value()
+		var token string
+		if o.managementTokens != nil {
+			var err error
+			token, err = o.managementTokens.Token(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to obtain management token: %w", err)
+			}
+			authorization = "Bearer " + token
+		}
+
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Authorization", authorization)
+		req.Header.Set("Accept", "application/json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := o.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute request: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || o.managementTokens == nil || attempt > 0 {
+			return resp, nil
+		}
+
+		_ = resp.Body.Close()
+		o.managementTokens.Invalidate(token)
+	}
+}
+
+// oktaClientAssertion builds the private_key_jwt client authentication used to
+// obtain Management API access tokens for an Okta service app
+func oktaClientAssertion(management *config.OktaManagementConfig, tokenURL string) (func() (url.Values, error), error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(management.PrivateKey.Value()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Okta management private key: %w", err)
+	}
+
+	scopes := management.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"okta.users.manage", "okta.groups.manage"}
+	}
+
+	return func() (url.Values, error) {
+		now := time.Now()
+		assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+			Issuer:    management.ClientID,
+			Subject:   management.ClientID,
+			Audience:  jwt.ClaimStrings{tokenURL},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+			ID:        uuid.New().String(),
+		})
+		if management.KeyID != "" {
+			assertion.Header["kid"] = management.KeyID
+		}
+
+		signed, err := assertion.SignedString(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign client assertion: %w", err)
+		}
+
+		data := url.Values{}
+		data.Set("scope", strings.Join(scopes, " "))
+		data.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		data.Set("client_assertion", signed)
+		return data, nil
+	}, nil
+}
+
+// NewOktaProvider creates a new OktaProvider instance
+func NewOktaProvider(cfg config.OktaConfig) (IAMProvider, error) {
+	if cfg.OrgURL == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("missing required Okta configuration")
+	}
+
+	management := cfg.Management
+	if management.APIToken == "" && (management.ClientID == "" || management.PrivateKey == "") {
+		return nil, fmt.Errorf("missing Okta management credentials: set api_token or client_id and private_key")
+	}
+
+	switch strings.ToLower(cfg.TokenValidation.Mode) {
+	case "", "remote", "local":
+	default:
+		return nil, fmt.Errorf("invalid Okta token validation mode: %s", cfg.TokenValidation.Mode)
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	orgURL := strings.TrimSuffix(cfg.OrgURL, "/")
+	issuer := orgURL
+	if cfg.AuthorizationServerID != "" {
+		issuer = fmt.Sprintf("%s/oauth2/%s", orgURL, cfg.AuthorizationServerID)
+	}
+
+	provider := &OktaProvider{
+		OIDCProvider: newOIDCProvider(config.OIDCConfig{
+			Issuer:          issuer,
+			ClientID:        cfg.ClientID,
+			ClientSecret:    cfg.ClientSecret,
+			Scopes:          cfg.Scopes,
+			TokenValidation: cfg.TokenValidation,
+		}, client),
+		config: &cfg,
+		client: client,
+	}
+
+	// Management API tokens always come from the org authorization server
+	if management.APIToken == "" {
+		tokenURL := orgURL + "/oauth2/v1/token"
+		credentials, err := oktaClientAssertion(&provider.config.Management, tokenURL)
+		if err != nil {
+			return nil, err
+		}
+		provider.managementTokens = newAdminTokenManagerWithCredentials(tokenURL, client, credentials)
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,34 @@
+package provider_test
+
+import (
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+)
+
+func TestOktaProviderConformance(t *testing.T) {
+	for _, mode := range []string{"remote", "local"} {
+		t.Run(mode, func(t *testing.T) {
+			providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+				server := providertest.NewOktaServer(t)
+				// Page through groups one at a time, past a group whose name
+				// starts with that of the fixture role
+				server.PageSize = 1
+				server.AddRole("users:admins")
+				f := providertest.Seed(server)
+
+				cfg := server.Config()
+				cfg.TokenValidation.Mode = mode
+
+				p, err := provider.NewOktaProvider(cfg)
+				if err != nil {
+					t.Fatalf("failed to create provider: %v", err)
+				}
+
+				f.Provider = p
+				return f
+			})
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package providertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// Auth0Server is an in-memory fake of an Auth0 tenant used by
+// provider.Auth0Provider: the OAuth endpoints, served by the embedded
+// OIDCServer with Auth0's trailing slash issuer and without introspection,
+// and the Management API v2 for users and roles. Management API tokens are
+// obtained with the client credentials grant.
+type Auth0Server struct {
+	*OIDCServer
+
+	// Audience is the API that user tokens are issued for
+	Audience string
+}
+
+// auth0ErrorBody is the error body of the Management API
+type auth0ErrorBody struct {
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	ErrorCode  string `json:"errorCode,omitempty"`
+}
+
+// NewAuth0Server starts a fake Auth0 tenant without users or roles, whose
+// users log in through the "Username-Password-Authentication" connection.
+// The server is closed when the test finishes.
+func NewAuth0Server(t testing.TB) *Auth0Server {
+	t.Helper()
+
+	s := &Auth0Server{
+		Audience: "https://api.example.com",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/users/{id}", s.management(s.handleGetUser))
+	mux.HandleFunc("PATCH /api/v2/users/{id}", s.management(s.handleUpdateUser))
+	mux.HandleFunc("GET /api/v2/users/{id}/roles", s.management(s.handleGetUserRoles))
+	mux.HandleFunc("POST /api/v2/users/{id}/roles", s.management(s.handleModifyUserRoles))
+	mux.HandleFunc("DELETE /api/v2/users/{id}/roles", s.management(s.handleModifyUserRoles))
+	mux.HandleFunc("GET /api/v2/roles", s.management(s.handleListRoles))
+
+	s.OIDCServer = newOIDCServer(t, mux)
+	s.Issuer = s.URL + "/"
+	s.Connection = "Username-Password-Authentication"
+	s.DisableIntrospection = true
+	s.userIDPrefix = "auth0|"
+	s.roleIDPrefix = "rol_"
+
+	return s
+}
+
+// Config returns an Auth0 configuration pointing at the fake
+func (s *Auth0Server) Config() config.Auth0Config {
+	return config.Auth0Config{
+		Domain:       s.URL,
+		ClientID:     s.ClientID,
+		ClientSecret: config.Secret(s.ClientSecret),
+		Audience:     s.Audience,
+		Connection:   s.Connection,
+	}
+}
+
+func (s *Auth0Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeAuth0UserNotFound(w)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, auth0UserRepresentation(user))
+}
+
+func (s *Auth0Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAuth0Error(w, http.StatusBadRequest, "Payload validation error: Invalid JSON.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeAuth0UserNotFound(w)
+		return
+	}
+
+	username, email := body["username"], body["email"]
+	if (username != "" || email != "") && body["connection"] != s.Connection {
+		writeAuth0Error(w, http.StatusBadRequest, "connection is required when updating email or username")
+		return
+	}
+	for _, other := range s.users {
+		if other == user {
+			continue
+		}
+		if username != "" && strings.EqualFold(other.Username, username) {
+			writeAuth0Error(w, http.StatusConflict, "The specified new username already exists")
+			return
+		}
+		if email != "" && strings.EqualFold(other.Email, email) {
+			writeAuth0Error(w, http.StatusConflict, "The specified new email already exists")
+			return
+		}
+	}
+
+	if username != "" {
+		user.Username = username
+	}
+	if email != "" {
+		user.Email = email
+	}
+
+	writeJSON(w, http.StatusOK, auth0UserRepresentation(user))
+}
+
+func (s *Auth0Server) handleGetUserRoles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeAuth0UserNotFound(w)
+		return
+	}
+
+	page, perPage := auth0Page(r)
+	names, _ := paginate(append([]string{}, user.Roles...), page*perPage, perPage)
+
+	writeJSON(w, http.StatusOK, s.roleRepresentations(names))
+}
+
+func (s *Auth0Server) handleModifyUserRoles(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Roles) == 0 {
+		writeAuth0Error(w, http.StatusBadRequest, "Payload validation error: roles is required.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeAuth0UserNotFound(w)
+		return
+	}
+
+	for _, id := range body.Roles {
+		role := s.roleName(id)
+		if role == "" {
+			writeAuth0Error(w, http.StatusNotFound, "The role does not exist.")
+			return
+		}
+
+		user.Roles = setRole(user.Roles, role, r.Method == http.MethodPost)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Auth0Server) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// name_filter matches case-insensitively anywhere in the name
+	filter := strings.ToLower(r.URL.Query().Get("name_filter"))
+	var names []string
+	for name := range s.roles {
+		if strings.Contains(strings.ToLower(name), filter) {
+			names = append(names, name)
+		}
+	}
+	total := len(names)
+
+	page, perPage := auth0Page(r)
+	start := page * perPage
+	names, _ = paginate(names, start, perPage)
+
+	if r.URL.Query().Get("include_totals") != "true" {
+		writeJSON(w, http.StatusOK, s.roleRepresentations(names))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"roles": s.roleRepresentations(names),
+		"start": start,
+		"limit": perPage,
+		"total": total,
+	})
+}
+
+// management wraps a Management API handler, requiring an access token issued
+// for the Management API audience
+func (s *Auth0Server) management(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := s.parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if err != nil || claims["aud"] != s.URL+"/api/v2/" {
+			writeAuth0Error(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// roleRepresentations builds the Auth0 role objects of the named roles;
+// callers must hold the lock
+func (s *Auth0Server) roleRepresentations(names []string) []map[string]string {
+	roles := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		roles = append(roles, map[string]string{
+			"id":          s.roles[name],
+			"name":        name,
+			"description": name,
+		})
+	}
+	return roles
+}
+
+// auth0UserRepresentation builds an Auth0 user object
+func auth0UserRepresentation(user *User) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":        user.ID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+	}
+}
+
+// auth0Page returns the page and per_page parameters of a list request,
+// defaulting to the first page of 50 items
+func auth0Page(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 50
+	}
+	return max(page, 0), perPage
+}
+
+// writeAuth0UserNotFound writes the Management API error for an unknown user
+func writeAuth0UserNotFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, auth0ErrorBody{
+		StatusCode: http.StatusNotFound,
+		Error:      http.StatusText(http.StatusNotFound),
+		Message:    "The user does not exist.",
+		ErrorCode:  "inexistent_user",
+	})
+}
+
+// writeAuth0Error writes a Management API error
+func writeAuth0Error(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, auth0ErrorBody{
+		StatusCode: status,
+		Error:      http.StatusText(status),
+		Message:    message,
+	})
+}
@@ -0,0 +1,419 @@
+package providertest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// cognitoTargetPrefix prefixes the X-Amz-Target header of every API call
+const cognitoTargetPrefix = "AWSCognitoIdentityProviderService."
+
+// CognitoServer is an in-memory fake of the Cognito user pool API used by
+// provider.CognitoProvider, served as AWS JSON 1.1 at the root of the server,
+// and of the pool's JWKS endpoint. Access and ID tokens are RS256 JWTs and
+// refresh tokens are opaque JWE-shaped strings. Admin calls must be signed
+// with the access key returned by Config. User IDs are subs and roles are
+// served as groups.
+type CognitoServer struct {
+	*httptest.Server
+
+	Region     string
+	UserPoolID string
+	ClientID   string
+	// ClientSecret, when set, requires a SECRET_HASH on authentication and
+	// the secret on token revocation
+	ClientSecret string
+	AccessKeyID  string
+	// PageSize is how many groups are listed per page when the request sets
+	// no limit
+	PageSize int
+
+	mu     sync.Mutex
+	users  map[string]*User
+	groups map[string]bool
+	// refreshTokens maps refresh tokens to user subs
+	refreshTokens map[string]string
+}
+
+// cognitoRequest holds the input members of the API calls the fake serves
+type cognitoRequest struct {
+	AuthFlow       string
+	AuthParameters map[string]string
+	ClientId       string
+	ClientSecret   string
+	AccessToken    string
+	Token          string
+	UserPoolId     string
+	Username       string
+	GroupName      string
+	UserAttributes []cognitoAttribute
+	Limit          int
+	NextToken      string
+}
+
+// cognitoAttribute is a user attribute
+type cognitoAttribute struct {
+	Name  string
+	Value string
+}
+
+// NewCognitoServer starts a fake Cognito user pool without users or groups,
+// whose app client has no secret. The server is closed when the test finishes.
+func NewCognitoServer(t testing.TB) *CognitoServer {
+	t.Helper()
+
+	s := &CognitoServer{
+		Region:        "us-east-1",
+		UserPoolID:    "us-east-1_providertest",
+		ClientID:      "iam-bridge",
+		AccessKeyID:   "providertest-access-key",
+		PageSize:      25,
+		users:         make(map[string]*User),
+		groups:        make(map[string]bool),
+		refreshTokens: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{$}", s.handleAPI)
+	mux.HandleFunc("GET /{pool}/.well-known/jwks.json", s.handleJWKS)
+
+	s.Server = startServer(t, mux)
+
+	return s
+}
+
+// Config returns a Cognito configuration pointing at the fake
+func (s *CognitoServer) Config() config.CognitoConfig {
+	return config.CognitoConfig{
+		Region:          s.Region,
+		UserPoolID:      s.UserPoolID,
+		ClientID:        s.ClientID,
+		ClientSecret:    config.Secret(s.ClientSecret),
+		Endpoint:        s.URL,
+		AccessKeyID:     s.AccessKeyID,
+		SecretAccessKey: "providertest-secret-key",
+	}
+}
+
+// AddRole creates a group
+func (s *CognitoServer) AddRole(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[name] = true
+}
+
+// AddUser creates a confirmed user, generating a sub when no ID is set. Roles
+// are the user's groups, which must have been created with AddRole.
+func (s *CognitoServer) AddUser(user User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	user.Roles = append([]string{}, user.Roles...)
+	s.users[user.ID] = &user
+
+	return &user
+}
+
+func (s *CognitoServer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("pool") != s.UserPoolID {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jwks())
+}
+
+func (s *CognitoServer) handleAPI(w http.ResponseWriter, r *http.Request) {
+	var req cognitoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeCognitoError(w, "SerializationException", err.Error())
+		return
+	}
+
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), cognitoTargetPrefix)
+	switch operation {
+	case "InitiateAuth":
+		s.initiateAuth(w, &req)
+	case "GlobalSignOut":
+		s.globalSignOut(w, &req)
+	case "RevokeToken":
+		s.revokeToken(w, &req)
+	case "AdminGetUser", "AdminUpdateUserAttributes", "AdminAddUserToGroup",
+		"AdminRemoveUserFromGroup", "AdminListGroupsForUser":
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.AccessKeyID+"/") {
+			writeCognitoError(w, "UnrecognizedClientException", "The security token included in the request is invalid.")
+			return
+		}
+		if req.UserPoolId != s.UserPoolID {
+			writeCognitoError(w, "ResourceNotFoundException", "User pool "+req.UserPoolId+" does not exist.")
+			return
+		}
+		s.admin(w, operation, &req)
+	default:
+		writeCognitoError(w, "UnknownOperationException", "Unknown operation "+operation)
+	}
+}
+
+func (s *CognitoServer) initiateAuth(w http.ResponseWriter, req *cognitoRequest) {
+	if req.ClientId != s.ClientID {
+		writeCognitoError(w, "ResourceNotFoundException", "User pool client "+req.ClientId+" does not exist.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var user *User
+	var refreshToken string
+	switch req.AuthFlow {
+	case "USER_PASSWORD_AUTH":
+		user = s.findUser(req.AuthParameters["USERNAME"])
+		if user == nil {
+			writeCognitoError(w, "UserNotFoundException", "User does not exist.")
+			return
+		}
+		if !s.secretHashValid(req.AuthParameters, req.AuthParameters["USERNAME"]) {
+			writeCognitoError(w, "NotAuthorizedException", "Unable to verify secret hash for client "+s.ClientID)
+			return
+		}
+		if user.Password != req.AuthParameters["PASSWORD"] {
+			writeCognitoError(w, "NotAuthorizedException", "Incorrect username or password.")
+			return
+		}
+
+		refreshToken = cognitoRefreshToken()
+		s.refreshTokens[refreshToken] = user.ID
+	case "REFRESH_TOKEN_AUTH":
+		user = s.users[s.refreshTokens[req.AuthParameters["REFRESH_TOKEN"]]]
+		if user == nil {
+			writeCognitoError(w, "NotAuthorizedException", "Invalid Refresh Token")
+			return
+		}
+		if !s.secretHashValid(req.AuthParameters, user.Username) {
+			writeCognitoError(w, "NotAuthorizedException", "Unable to verify secret hash for client "+s.ClientID)
+			return
+		}
+	default:
+		writeCognitoError(w, "InvalidParameterException", "Unsupported auth flow "+req.AuthFlow)
+		return
+	}
+
+	accessToken, err := s.sign(jwt.MapClaims{
+		"sub":       user.ID,
+		"token_use": "access",
+		"client_id": s.ClientID,
+		"username":  user.Username,
+		"scope":     "aws.cognito.signin.user.admin",
+	}, user)
+	if err != nil {
+		writeCognitoError(w, "InternalErrorException", err.Error())
+		return
+	}
+	idToken, err := s.sign(jwt.MapClaims{
+		"sub":              user.ID,
+		"aud":              s.ClientID,
+		"token_use":        "id",
+		"cognito:username": user.Username,
+		"email":            user.Email,
+	}, user)
+	if err != nil {
+		writeCognitoError(w, "InternalErrorException", err.Error())
+		return
+	}
+
+	result := map[string]interface{}{
+		"AccessToken": accessToken,
+		"IdToken":     idToken,
+		"TokenType":   "Bearer",
+		"ExpiresIn":   int64(tokenTTL.Seconds()),
+	}
+	// Refreshing does not issue a new refresh token
+	if refreshToken != "" {
+		result["RefreshToken"] = refreshToken
+	}
+
+	writeCognitoJSON(w, map[string]interface{}{
+		"AuthenticationResult": result,
+		"ChallengeParameters":  map[string]string{},
+	})
+}
+
+func (s *CognitoServer) globalSignOut(w http.ResponseWriter, req *cognitoRequest) {
+	claims, err := s.parse(req.AccessToken)
+	if err != nil || claims["token_use"] != "access" {
+		writeCognitoError(w, "NotAuthorizedException", "Invalid Access Token")
+		return
+	}
+
+	// Signing out everywhere revokes all of the user's refresh tokens
+	s.mu.Lock()
+	for token, sub := range s.refreshTokens {
+		if sub == claims["sub"] {
+			delete(s.refreshTokens, token)
+		}
+	}
+	s.mu.Unlock()
+
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+func (s *CognitoServer) revokeToken(w http.ResponseWriter, req *cognitoRequest) {
+	if req.ClientId != s.ClientID || req.ClientSecret != s.ClientSecret {
+		writeCognitoError(w, "UnauthorizedException", "Invalid client credentials")
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.refreshTokens, req.Token)
+	s.mu.Unlock()
+
+	writeCognitoJSON(w, map[string]interface{}{})
+}
+
+// admin serves the admin API calls, which address users by username or sub
+func (s *CognitoServer) admin(w http.ResponseWriter, operation string, req *cognitoRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findUser(req.Username)
+	if user == nil {
+		writeCognitoError(w, "UserNotFoundException", "User does not exist.")
+		return
+	}
+
+	switch operation {
+	case "AdminGetUser":
+		writeCognitoJSON(w, map[string]interface{}{
+			"Username": user.Username,
+			"UserAttributes": []cognitoAttribute{
+				{Name: "sub", Value: user.ID},
+				{Name: "email", Value: user.Email},
+			},
+			"Enabled":    true,
+			"UserStatus": "CONFIRMED",
+		})
+	case "AdminUpdateUserAttributes":
+		for _, attribute := range req.UserAttributes {
+			if attribute.Name != "email" {
+				writeCognitoError(w, "InvalidParameterException", "Attribute "+attribute.Name+" cannot be updated.")
+				return
+			}
+			user.Email = attribute.Value
+		}
+		writeCognitoJSON(w, map[string]interface{}{})
+	case "AdminAddUserToGroup", "AdminRemoveUserFromGroup":
+		if !s.groups[req.GroupName] {
+			writeCognitoError(w, "ResourceNotFoundException", "Group not found.")
+			return
+		}
+
+		user.Roles = setRole(user.Roles, req.GroupName, operation == "AdminAddUserToGroup")
+
+		writeCognitoJSON(w, map[string]interface{}{})
+	case "AdminListGroupsForUser":
+		limit := req.Limit
+		if limit <= 0 {
+			limit = s.PageSize
+		}
+		start, _ := strconv.Atoi(req.NextToken)
+		names, next := paginate(append([]string{}, user.Roles...), start, limit)
+
+		groups := make([]map[string]string, 0, len(names))
+		for _, name := range names {
+			groups = append(groups, map[string]string{"GroupName": name, "UserPoolId": s.UserPoolID})
+		}
+		output := map[string]interface{}{"Groups": groups}
+		if next > 0 {
+			output["NextToken"] = strconv.Itoa(next)
+		}
+		writeCognitoJSON(w, output)
+	}
+}
+
+// findUser returns the user with the given username, matched
+// case-insensitively, or sub; callers must hold the lock
+func (s *CognitoServer) findUser(username string) *User {
+	if user, ok := s.users[username]; ok {
+		return user
+	}
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+// secretHashValid checks the SECRET_HASH parameter of an authentication
+// request when the app client has a secret
+func (s *CognitoServer) secretHashValid(params map[string]string, username string) bool {
+	if s.ClientSecret == "" {
+		return true
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.ClientSecret))
+	mac.Write([]byte(username + s.ClientID))
+	return params["SECRET_HASH"] == base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sign adds the authentication time and the user's groups, and signs a token
+// issued by the pool; callers must hold the lock
+func (s *CognitoServer) sign(claims jwt.MapClaims, user *User) (string, error) {
+	claims["auth_time"] = time.Now().Unix()
+	if len(user.Roles) > 0 {
+		claims["cognito:groups"] = append([]string{}, user.Roles...)
+	}
+	return signToken(s.issuer(), claims)
+}
+
+// parse verifies a token issued by the pool
+func (s *CognitoServer) parse(token string) (jwt.MapClaims, error) {
+	return parseToken(s.issuer(), token)
+}
+
+// issuer returns the pool issuer URL
+func (s *CognitoServer) issuer() string {
+	return s.URL + "/" + s.UserPoolID
+}
+
+// cognitoRefreshToken returns an opaque refresh token shaped like the JWEs
+// Cognito issues, which have five segments and a JSON header
+func cognitoRefreshToken() string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"cty":"JWT","enc":"A256GCM","alg":"RSA-OAEP"}`))
+	return strings.Join([]string{header, randomToken(), randomToken(), randomToken(), randomToken()}, ".")
+}
+
+// writeCognitoJSON writes an AWS JSON 1.1 response
+func writeCognitoJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeCognitoError writes an AWS JSON 1.1 error of the given exception type
+func writeCognitoError(w http.ResponseWriter, errorType, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", errorType)
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"__type":  errorType,
+		"message": message,
+	})
+}
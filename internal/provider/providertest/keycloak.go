@@ -0,0 +1,501 @@
+package providertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// KeycloakServer is an in-memory fake of the Keycloak endpoints used by
+// provider.KeycloakProvider: the OIDC token, userinfo, logout and certs
+// endpoints, the admin REST API for users and realm roles, and /health.
+// Tokens are RS256 JWTs signed with a key published on the certs endpoint.
+type KeycloakServer struct {
+	*httptest.Server
+
+	Realm        string
+	ClientID     string
+	ClientSecret string
+
+	mu    sync.Mutex
+	users map[string]*User
+	roles map[string]string
+	// sessions maps active session IDs to user IDs
+	sessions map[string]string
+}
+
+// NewKeycloakServer starts a fake Keycloak with an empty realm. The server is
+// closed when the test finishes.
+func NewKeycloakServer(t testing.TB) *KeycloakServer {
+	t.Helper()
+
+	s := &KeycloakServer{
+		Realm:        "test",
+		ClientID:     "iam-bridge",
+		ClientSecret: "iam-bridge-secret",
+		users:        make(map[string]*User),
+		roles:        make(map[string]string),
+		sessions:     make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("POST /realms/{realm}/protocol/openid-connect/token", s.handleToken)
+	mux.HandleFunc("GET /realms/{realm}/protocol/openid-connect/userinfo", s.handleUserInfo)
+	mux.HandleFunc("POST /realms/{realm}/protocol/openid-connect/logout", s.handleLogout)
+	mux.HandleFunc("GET /realms/{realm}/protocol/openid-connect/certs", s.handleCerts)
+	mux.HandleFunc("GET /admin/realms/{realm}/users/{id}", s.admin(s.handleGetUser))
+	mux.HandleFunc("PUT /admin/realms/{realm}/users/{id}", s.admin(s.handleUpdateUser))
+	mux.HandleFunc("GET /admin/realms/{realm}/roles/{name}", s.admin(s.handleGetRole))
+	mux.HandleFunc("GET /admin/realms/{realm}/users/{id}/role-mappings/realm", s.admin(s.handleGetRoleMappings))
+	mux.HandleFunc("POST /admin/realms/{realm}/users/{id}/role-mappings/realm", s.admin(s.handleModifyRoleMappings))
+	mux.HandleFunc("DELETE /admin/realms/{realm}/users/{id}/role-mappings/realm", s.admin(s.handleModifyRoleMappings))
+
+	s.Server = startServer(t, mux)
+
+	return s
+}
+
+// Config returns a Keycloak configuration pointing at the fake
+func (s *KeycloakServer) Config() config.KeycloakConfig {
+	return config.KeycloakConfig{
+		BaseURL:      s.URL,
+		Realm:        s.Realm,
+		ClientID:     s.ClientID,
+		ClientSecret: config.Secret(s.ClientSecret),
+	}
+}
+
+// AddRole creates a realm role
+func (s *KeycloakServer) AddRole(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roles[name] = uuid.New().String()
+}
+
+// AddUser creates a user, generating an ID when none is set. Roles must have
+// been created with AddRole.
+func (s *KeycloakServer) AddUser(user User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	user.Roles = append([]string{}, user.Roles...)
+	s.users[user.ID] = &user
+
+	return &user
+}
+
+// User returns a copy of the user with the given ID, as currently stored
+func (s *KeycloakServer) User(id string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, false
+	}
+	return *user, true
+}
+
+func (s *KeycloakServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "UP"})
+}
+
+func (s *KeycloakServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if !s.realmMatches(w, r) || !s.clientAuthenticated(w, r) {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "password":
+		s.mu.Lock()
+		user := s.findByUsername(r.PostForm.Get("username"))
+		if user == nil || user.Password != r.PostForm.Get("password") {
+			s.mu.Unlock()
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_grant", "Invalid user credentials")
+			return
+		}
+		sessionID := uuid.New().String()
+		s.sessions[sessionID] = user.ID
+		s.mu.Unlock()
+
+		s.writeTokens(w, user, sessionID)
+	case "refresh_token":
+		claims, err := s.parse(r.PostForm.Get("refresh_token"), "Refresh")
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+			return
+		}
+
+		sessionID, _ := claims["sid"].(string)
+		s.mu.Lock()
+		userID, active := s.sessions[sessionID]
+		user := s.users[userID]
+		s.mu.Unlock()
+		if !active || user == nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Session not active")
+			return
+		}
+
+		s.writeTokens(w, user, sessionID)
+	case "client_credentials":
+		token, err := s.sign(jwt.MapClaims{
+			"sub":                "service-account-" + s.ClientID,
+			"typ":                "Bearer",
+			"azp":                s.ClientID,
+			"preferred_username": "service-account-" + s.ClientID,
+		})
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int64(tokenTTL.Seconds()),
+		})
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant_type")
+	}
+}
+
+func (s *KeycloakServer) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if !s.realmMatches(w, r) {
+		return
+	}
+
+	claims, err := s.parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), "Bearer")
+	if err != nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "Token verification failed")
+		return
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	s.mu.Lock()
+	user := s.users[s.sessions[sessionID]]
+	s.mu.Unlock()
+	if user == nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "User session not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":                user.ID,
+		"preferred_username": user.Username,
+		"email":              user.Email,
+	})
+}
+
+func (s *KeycloakServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if !s.realmMatches(w, r) || !s.clientAuthenticated(w, r) {
+		return
+	}
+
+	claims, err := s.parse(r.PostForm.Get("refresh_token"), "Refresh")
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	s.mu.Lock()
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *KeycloakServer) handleCerts(w http.ResponseWriter, r *http.Request) {
+	if !s.realmMatches(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jwks())
+}
+
+func (s *KeycloakServer) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userRepresentation(user))
+}
+
+func (s *KeycloakServer) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unable to read contents from stream"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	username, _ := body["username"].(string)
+	email, _ := body["email"].(string)
+	for _, other := range s.users {
+		if other == user {
+			continue
+		}
+		if username != "" && strings.EqualFold(other.Username, username) {
+			writeJSON(w, http.StatusConflict, map[string]string{"errorMessage": "User exists with same username"})
+			return
+		}
+		if email != "" && strings.EqualFold(other.Email, email) {
+			writeJSON(w, http.StatusConflict, map[string]string{"errorMessage": "User exists with same email"})
+			return
+		}
+	}
+
+	if username != "" {
+		user.Username = strings.ToLower(username)
+	}
+	if email != "" {
+		user.Email = email
+	}
+	if verified, ok := body["emailVerified"].(bool); ok {
+		user.EmailVerified = verified
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *KeycloakServer) handleGetRole(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := r.PathValue("name")
+	id, ok := s.roles[name]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Could not find role"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.roleRepresentation(name, id))
+}
+
+func (s *KeycloakServer) handleGetRoleMappings(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	mappings := make([]map[string]interface{}, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		mappings = append(mappings, s.roleRepresentation(role, s.roles[role]))
+	}
+
+	writeJSON(w, http.StatusOK, mappings)
+}
+
+func (s *KeycloakServer) handleModifyRoleMappings(w http.ResponseWriter, r *http.Request) {
+	var body []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unable to read contents from stream"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	for _, role := range body {
+		if id, ok := s.roles[role.Name]; !ok || id != role.ID {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Could not find role"})
+			return
+		}
+
+		user.Roles = setRole(user.Roles, role.Name, r.Method == http.MethodPost)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// admin wraps an admin REST API handler, requiring a service account token
+// and the fake's realm
+func (s *KeycloakServer) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.realmMatches(w, r) {
+			return
+		}
+
+		claims, err := s.parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), "Bearer")
+		if err != nil || claims["sub"] != "service-account-"+s.ClientID {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "HTTP 401 Unauthorized"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// realmMatches writes a 404 when the request is for another realm
+func (s *KeycloakServer) realmMatches(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("realm") != s.Realm {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Realm does not exist"})
+		return false
+	}
+	return true
+}
+
+// clientAuthenticated checks the client credentials posted with the form
+func (s *KeycloakServer) clientAuthenticated(w http.ResponseWriter, r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return false
+	}
+
+	if r.PostForm.Get("client_id") != s.ClientID || r.PostForm.Get("client_secret") != s.ClientSecret {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Invalid client or Invalid client credentials")
+		return false
+	}
+	return true
+}
+
+// writeTokens issues an access, ID and refresh token for a user session
+func (s *KeycloakServer) writeTokens(w http.ResponseWriter, user *User, sessionID string) {
+	s.mu.Lock()
+	roles := append([]string{}, user.Roles...)
+	username, email := user.Username, user.Email
+	s.mu.Unlock()
+
+	accessToken, err := s.sign(jwt.MapClaims{
+		"sub":                user.ID,
+		"typ":                "Bearer",
+		"azp":                s.ClientID,
+		"sid":                sessionID,
+		"preferred_username": username,
+		"email":              email,
+		"realm_access":       map[string]interface{}{"roles": roles},
+	})
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	idToken, err := s.sign(jwt.MapClaims{
+		"sub":                user.ID,
+		"typ":                "ID",
+		"aud":                s.ClientID,
+		"azp":                s.ClientID,
+		"sid":                sessionID,
+		"preferred_username": username,
+		"email":              email,
+	})
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	refreshToken, err := s.sign(jwt.MapClaims{
+		"sub": user.ID,
+		"typ": "Refresh",
+		"azp": s.ClientID,
+		"sid": sessionID,
+	})
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":       accessToken,
+		"refresh_token":      refreshToken,
+		"id_token":           idToken,
+		"token_type":         "Bearer",
+		"expires_in":         int64(tokenTTL.Seconds()),
+		"refresh_expires_in": int64(tokenTTL.Seconds()),
+		"scope":              "openid profile email",
+	})
+}
+
+// issuer returns the realm issuer URL
+func (s *KeycloakServer) issuer() string {
+	return fmt.Sprintf("%s/realms/%s", s.URL, s.Realm)
+}
+
+// sign signs a token issued by the realm
+func (s *KeycloakServer) sign(claims jwt.MapClaims) (string, error) {
+	return signToken(s.issuer(), claims)
+}
+
+// parse verifies a token issued by the realm and checks its typ claim
+func (s *KeycloakServer) parse(token, typ string) (jwt.MapClaims, error) {
+	claims, err := parseToken(s.issuer(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims["typ"] != typ {
+		return nil, fmt.Errorf("token is not of type %s", typ)
+	}
+	return claims, nil
+}
+
+// findByUsername returns the user with the given username; callers must hold the lock
+func (s *KeycloakServer) findByUsername(username string) *User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+// roleRepresentation builds a Keycloak RoleRepresentation of a realm role
+func (s *KeycloakServer) roleRepresentation(name, id string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          id,
+		"name":        name,
+		"composite":   false,
+		"clientRole":  false,
+		"containerId": s.Realm,
+	}
+}
+
+// userRepresentation builds a Keycloak UserRepresentation of a user
+func userRepresentation(user *User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            user.ID,
+		"username":      user.Username,
+		"email":         user.Email,
+		"enabled":       true,
+		"emailVerified": user.EmailVerified,
+	}
+}
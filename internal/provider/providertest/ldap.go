@@ -0,0 +1,537 @@
+package providertest
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// LDAP protocol operations, as application tags
+const (
+	ldapBindRequest      ber.Tag = 0
+	ldapBindResponse     ber.Tag = 1
+	ldapUnbindRequest    ber.Tag = 2
+	ldapSearchRequest    ber.Tag = 3
+	ldapSearchEntry      ber.Tag = 4
+	ldapSearchDone       ber.Tag = 5
+	ldapModifyRequest    ber.Tag = 6
+	ldapModifyResponse   ber.Tag = 7
+	ldapAbandonRequest   ber.Tag = 16
+	ldapExtendedResponse ber.Tag = 24
+)
+
+// LDAP search filter choices, as context-specific tags
+const (
+	ldapFilterAnd      ber.Tag = 0
+	ldapFilterOr       ber.Tag = 1
+	ldapFilterNot      ber.Tag = 2
+	ldapFilterEquality ber.Tag = 3
+	ldapFilterPresent  ber.Tag = 7
+)
+
+// LDAP result codes returned by the fake
+const (
+	ldapSuccess                  = 0
+	ldapProtocolError            = 2
+	ldapSizeLimitExceeded        = 4
+	ldapNoSuchAttribute          = 16
+	ldapAttributeOrValueExists   = 20
+	ldapNoSuchObject             = 32
+	ldapInvalidCredentials       = 49
+	ldapInsufficientAccessRights = 50
+)
+
+// LDAPServer is an in-memory fake of an OpenLDAP-style directory used by
+// provider.LDAPProvider, speaking LDAPv3 over plain TCP. It supports simple
+// binds, searches with and, or, not, equality and presence filters, and
+// modifications. Users are inetOrgPerson entries under ou=people and groups
+// are groupOfNames entries under ou=groups; memberOf is computed from group
+// membership like the OpenLDAP memberof overlay. Paging controls are ignored,
+// so searches return all entries at once. User IDs are uids, which are the
+// usernames, and roles are served as groups.
+type LDAPServer struct {
+	// URL is the ldap:// URL of the server
+	URL          string
+	BindDN       string
+	BindPassword string
+	UserBaseDN   string
+	GroupBaseDN  string
+
+	listener net.Listener
+
+	mu sync.Mutex
+	// entries maps lower-cased DNs to entries
+	entries map[string]*ldapEntry
+	conns   map[net.Conn]bool
+}
+
+// ldapEntry is an entry of the fake directory
+type ldapEntry struct {
+	dn         string
+	attributes map[string][]string
+	password   string
+}
+
+// NewLDAPServer starts a fake directory holding the dc=example,dc=com suffix
+// and its people and groups organizational units. The server is closed when
+// the test finishes.
+func NewLDAPServer(t testing.TB) *LDAPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &LDAPServer{
+		URL:          "ldap://" + listener.Addr().String(),
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "admin-password",
+		UserBaseDN:   "ou=people,dc=example,dc=com",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+		listener:     listener,
+		entries:      make(map[string]*ldapEntry),
+		conns:        make(map[net.Conn]bool),
+	}
+	s.add(&ldapEntry{dn: "dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"top", "domain"},
+		"dc":          {"example"},
+	}})
+	for _, dn := range []string{s.UserBaseDN, s.GroupBaseDN} {
+		s.add(&ldapEntry{dn: dn, attributes: map[string][]string{
+			"objectClass": {"top", "organizationalUnit"},
+			"ou":          {strings.TrimPrefix(strings.SplitN(dn, ",", 2)[0], "ou=")},
+		}})
+	}
+
+	go s.serve()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Config returns an LDAP configuration pointing at the fake, with group
+// search enabled
+func (s *LDAPServer) Config() config.LDAPConfig {
+	return config.LDAPConfig{
+		URL:          s.URL,
+		BindDN:       s.BindDN,
+		BindPassword: config.Secret(s.BindPassword),
+		UserBaseDN:   s.UserBaseDN,
+		GroupBaseDN:  s.GroupBaseDN,
+	}
+}
+
+// AddRole creates an empty group
+func (s *LDAPServer) AddRole(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(&ldapEntry{dn: "cn=" + name + "," + s.GroupBaseDN, attributes: map[string][]string{
+		"objectClass": {"top", "groupOfNames"},
+		"cn":          {name},
+	}})
+}
+
+// AddUser creates a user entry, whose ID is its username, and adds it to the
+// groups listed as its roles, which must have been created with AddRole
+func (s *LDAPServer) AddUser(user User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.ID = user.Username
+	user.Roles = append([]string{}, user.Roles...)
+	dn := "uid=" + user.Username + "," + s.UserBaseDN
+	s.add(&ldapEntry{dn: dn, password: user.Password, attributes: map[string][]string{
+		"objectClass": {"top", "person", "inetOrgPerson"},
+		"uid":         {user.Username},
+		"cn":          {user.Username},
+		"sn":          {user.Username},
+		"mail":        {user.Email},
+	}})
+	for _, group := range user.Roles {
+		entry := s.entries[strings.ToLower("cn="+group+","+s.GroupBaseDN)]
+		entry.attributes["member"] = append(entry.attributes["member"], dn)
+	}
+
+	return &user
+}
+
+// Close stops the listener and closes open connections
+func (s *LDAPServer) Close() {
+	_ = s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// add stores an entry; callers must hold the lock
+func (s *LDAPServer) add(entry *ldapEntry) {
+	s.entries[strings.ToLower(entry.dn)] = entry
+}
+
+func (s *LDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn serves the requests of a connection until it is unbound or closed
+func (s *LDAPServer) handleConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	// boundDN is the identity of the connection, anonymous until a bind
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch request.Tag {
+		case ldapBindRequest:
+			var code int
+			boundDN, code = s.bind(request, boundDN)
+			responses = append(responses, ldapResult(ldapBindResponse, code, ""))
+		case ldapUnbindRequest:
+			return
+		case ldapAbandonRequest:
+			continue
+		case ldapSearchRequest:
+			responses = s.search(request)
+		case ldapModifyRequest:
+			responses = append(responses, s.modify(request, boundDN))
+		default:
+			responses = append(responses, ldapResult(ldapExtendedResponse, ldapProtocolError, "unsupported operation"))
+		}
+
+		for _, response := range responses {
+			message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+			message.AppendChild(response)
+			if _, err := conn.Write(message.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind checks simple bind credentials against the service account and user
+// entries, and returns the new identity of the connection. An empty password
+// is an unauthenticated bind, which succeeds anonymously.
+func (s *LDAPServer) bind(request *ber.Packet, boundDN string) (string, int) {
+	if len(request.Children) < 3 {
+		return boundDN, ldapProtocolError
+	}
+
+	name := ldapString(request.Children[1])
+	password := ldapString(request.Children[2])
+	if password == "" {
+		return "", ldapSuccess
+	}
+
+	if strings.EqualFold(name, s.BindDN) && password == s.BindPassword {
+		return s.BindDN, ldapSuccess
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[strings.ToLower(name)]
+	if entry == nil || entry.password == "" || entry.password != password {
+		return "", ldapInvalidCredentials
+	}
+	return entry.dn, ldapSuccess
+}
+
+// search returns the entries matching a search request followed by the
+// search result
+func (s *LDAPServer) search(request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return []*ber.Packet{ldapResult(ldapSearchDone, ldapProtocolError, "malformed search request")}
+	}
+
+	baseDN := strings.ToLower(ldapString(request.Children[0]))
+	scope, _ := request.Children[1].Value.(int64)
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+	var attributes []string
+	for _, attribute := range request.Children[7].Children {
+		attributes = append(attributes, ldapString(attribute))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The root DSE is only visible to base searches
+	if baseDN == "" && scope == 0 {
+		root := &ldapEntry{attributes: map[string][]string{"objectClass": {"top"}}}
+		return []*ber.Packet{
+			s.entryPacket(root, attributes),
+			ldapResult(ldapSearchDone, ldapSuccess, ""),
+		}
+	}
+	if s.entries[baseDN] == nil {
+		return []*ber.Packet{ldapResult(ldapSearchDone, ldapNoSuchObject, "")}
+	}
+
+	dns := make([]string, 0, len(s.entries))
+	for dn := range s.entries {
+		dns = append(dns, dn)
+	}
+	sort.Strings(dns)
+
+	var responses []*ber.Packet
+	for _, dn := range dns {
+		if !inScope(dn, baseDN, scope) || !s.matches(s.entries[dn], filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) == sizeLimit {
+			return append(responses, ldapResult(ldapSearchDone, ldapSizeLimitExceeded, ""))
+		}
+		responses = append(responses, s.entryPacket(s.entries[dn], attributes))
+	}
+
+	return append(responses, ldapResult(ldapSearchDone, ldapSuccess, ""))
+}
+
+// modify applies a modify request, which only the service account may send
+func (s *LDAPServer) modify(request *ber.Packet, boundDN string) *ber.Packet {
+	if boundDN != s.BindDN {
+		return ldapResult(ldapModifyResponse, ldapInsufficientAccessRights, "")
+	}
+	if len(request.Children) < 2 {
+		return ldapResult(ldapModifyResponse, ldapProtocolError, "malformed modify request")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[strings.ToLower(ldapString(request.Children[0]))]
+	if entry == nil {
+		return ldapResult(ldapModifyResponse, ldapNoSuchObject, "")
+	}
+
+	// Changes are applied to a copy, so a failed request leaves the entry untouched
+	attributes := make(map[string][]string, len(entry.attributes))
+	for name, values := range entry.attributes {
+		attributes[name] = append([]string{}, values...)
+	}
+
+	for _, change := range request.Children[1].Children {
+		if len(change.Children) < 2 || len(change.Children[1].Children) < 2 {
+			return ldapResult(ldapModifyResponse, ldapProtocolError, "malformed change")
+		}
+		operation, _ := change.Children[0].Value.(int64)
+		name := attributeName(attributes, ldapString(change.Children[1].Children[0]))
+		var values []string
+		for _, value := range change.Children[1].Children[1].Children {
+			values = append(values, ldapString(value))
+		}
+
+		switch operation {
+		case 0: // add
+			for _, value := range values {
+				if containsFold(attributes[name], value) {
+					return ldapResult(ldapModifyResponse, ldapAttributeOrValueExists, "")
+				}
+				attributes[name] = append(attributes[name], value)
+			}
+		case 1: // delete
+			if len(values) == 0 {
+				delete(attributes, name)
+				continue
+			}
+			for _, value := range values {
+				if !containsFold(attributes[name], value) {
+					return ldapResult(ldapModifyResponse, ldapNoSuchAttribute, "")
+				}
+				remaining := attributes[name][:0]
+				for _, existing := range attributes[name] {
+					if !strings.EqualFold(existing, value) {
+						remaining = append(remaining, existing)
+					}
+				}
+				attributes[name] = remaining
+			}
+		case 2: // replace
+			attributes[name] = values
+		default:
+			return ldapResult(ldapModifyResponse, ldapProtocolError, "unknown modify operation")
+		}
+	}
+
+	entry.attributes = attributes
+	return ldapResult(ldapModifyResponse, ldapSuccess, "")
+}
+
+// matches evaluates a search filter against an entry; callers must hold the lock
+func (s *LDAPServer) matches(entry *ldapEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldapFilterAnd:
+		for _, child := range filter.Children {
+			if !s.matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldapFilterOr:
+		for _, child := range filter.Children {
+			if s.matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldapFilterNot:
+		return len(filter.Children) == 1 && !s.matches(entry, filter.Children[0])
+	case ldapFilterEquality:
+		if len(filter.Children) < 2 {
+			return false
+		}
+		values := s.values(entry, ldapString(filter.Children[0]))
+		return containsFold(values, ldapString(filter.Children[1]))
+	case ldapFilterPresent:
+		return len(s.values(entry, ldapString(filter))) > 0
+	default:
+		return false
+	}
+}
+
+// values returns the values of an attribute, matched case-insensitively.
+// memberOf lists the groups naming the entry as a member. Callers must hold
+// the lock.
+func (s *LDAPServer) values(entry *ldapEntry, name string) []string {
+	if !strings.EqualFold(name, "memberOf") {
+		return entry.attributes[attributeName(entry.attributes, name)]
+	}
+
+	var groups []string
+	for _, group := range s.entries {
+		if containsFold(group.attributes["member"], entry.dn) {
+			groups = append(groups, group.dn)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// entryPacket encodes a search result entry with the requested attributes,
+// or all attributes but memberOf when none are requested. "1.1" requests no
+// attributes. Callers must hold the lock.
+func (s *LDAPServer) entryPacket(entry *ldapEntry, requested []string) *ber.Packet {
+	names := requested
+	if len(names) == 0 || containsFold(names, "*") {
+		names = names[:0:0]
+		for name := range entry.attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, name := range names {
+		values := s.values(entry, name)
+		if name == "1.1" || name == "*" || len(values) == 0 {
+			continue
+		}
+
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchEntry, nil, "Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+	packet.AppendChild(attributes)
+	return packet
+}
+
+// ldapResult encodes an LDAPResult response of the given operation
+func ldapResult(operation ber.Tag, code int, message string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, operation, nil, "Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return packet
+}
+
+// ldapString returns the contents of a primitive packet, which are left
+// undecoded for context-specific tags
+func ldapString(packet *ber.Packet) string {
+	if value, ok := packet.Value.(string); ok {
+		return value
+	}
+	if packet.Data == nil {
+		return ""
+	}
+	return packet.Data.String()
+}
+
+// inScope reports whether dn is within the search scope of baseDN, with both
+// DNs lower-cased
+func inScope(dn, baseDN string, scope int64) bool {
+	switch scope {
+	case 0: // base object
+		return dn == baseDN
+	case 1: // single level
+		_, parent, found := strings.Cut(dn, ",")
+		return found && parent == baseDN
+	default: // whole subtree
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+// attributeName returns the stored name of an attribute matched
+// case-insensitively, or name itself when the attribute is not set
+func attributeName(attributes map[string][]string, name string) string {
+	for stored := range attributes {
+		if strings.EqualFold(stored, name) {
+			return stored
+		}
+	}
+	return name
+}
+
+// containsFold reports whether values holds value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
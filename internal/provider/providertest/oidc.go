@@ -0,0 +1,368 @@
+package providertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// OIDCServer is an in-memory fake of an OpenID provider used by
+// provider.OIDCProvider: the discovery document and the token, userinfo,
+// introspection, revocation and JWKS endpoints. The token endpoint supports
+// the password, refresh_token and client_credentials grants, and Auth0's
+// password-realm grant when Connection is set. Access tokens are RS256 JWTs
+// and refresh tokens are opaque. User roles are only reported by the
+// management APIs of fakes embedding the server.
+type OIDCServer struct {
+	*httptest.Server
+
+	// Issuer is advertised by discovery and set in tokens. It defaults to the
+	// server URL.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Connection is the realm required by the password-realm grant
+	Connection string
+	// DisableIntrospection leaves the introspection endpoint out of the
+	// discovery document, so that tokens are validated with userinfo
+	DisableIntrospection bool
+
+	// userIDPrefix and roleIDPrefix start generated IDs, in the format of the
+	// embedding fake
+	userIDPrefix string
+	roleIDPrefix string
+
+	mu    sync.Mutex
+	users map[string]*User
+	// roles maps role names to IDs
+	roles map[string]string
+	// sessions maps active session IDs to their sessions
+	sessions map[string]*oidcSession
+	// refreshTokens maps refresh tokens to session IDs
+	refreshTokens map[string]string
+}
+
+// oidcSession is a login session, which refreshed tokens keep the audience of
+type oidcSession struct {
+	userID   string
+	audience string
+}
+
+// NewOIDCServer starts a fake OpenID provider without users. The server is
+// closed when the test finishes.
+func NewOIDCServer(t testing.TB) *OIDCServer {
+	t.Helper()
+
+	return newOIDCServer(t, http.NewServeMux())
+}
+
+// newOIDCServer registers the OpenID endpoints on mux, next to those of the
+// fake embedding the server, and starts it
+func newOIDCServer(t testing.TB, mux *http.ServeMux) *OIDCServer {
+	s := &OIDCServer{
+		ClientID:      "iam-bridge",
+		ClientSecret:  "iam-bridge-secret",
+		users:         make(map[string]*User),
+		roles:         make(map[string]string),
+		sessions:      make(map[string]*oidcSession),
+		refreshTokens: make(map[string]string),
+	}
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("GET /.well-known/jwks.json", s.handleJWKS)
+	mux.HandleFunc("POST /oauth/token", s.handleToken)
+	mux.HandleFunc("GET /userinfo", s.handleUserInfo)
+	mux.HandleFunc("POST /oauth/introspect", s.handleIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", s.handleRevoke)
+
+	s.Server = startServer(t, mux)
+	s.Issuer = s.URL
+
+	return s
+}
+
+// Config returns an OIDC configuration pointing at the fake
+func (s *OIDCServer) Config() config.OIDCConfig {
+	return config.OIDCConfig{
+		Issuer:       s.Issuer,
+		ClientID:     s.ClientID,
+		ClientSecret: config.Secret(s.ClientSecret),
+	}
+}
+
+// AddRole creates a role
+func (s *OIDCServer) AddRole(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roles[name] = newID(s.roleIDPrefix, 20)
+}
+
+// AddUser creates a user, generating an ID when none is set. Roles must have
+// been created with AddRole.
+func (s *OIDCServer) AddUser(user User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID == "" {
+		user.ID = newID(s.userIDPrefix, 20)
+	}
+	user.Roles = append([]string{}, user.Roles...)
+	s.users[user.ID] = &user
+
+	return &user
+}
+
+func (s *OIDCServer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	discovery := map[string]string{
+		"issuer":              s.Issuer,
+		"token_endpoint":      s.URL + "/oauth/token",
+		"userinfo_endpoint":   s.URL + "/userinfo",
+		"jwks_uri":            s.URL + "/.well-known/jwks.json",
+		"revocation_endpoint": s.URL + "/oauth/revoke",
+	}
+	if !s.DisableIntrospection {
+		discovery["introspection_endpoint"] = s.URL + "/oauth/introspect"
+	}
+
+	writeJSON(w, http.StatusOK, discovery)
+}
+
+func (s *OIDCServer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jwks())
+}
+
+func (s *OIDCServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if !s.clientAuthenticated(w, r) {
+		return
+	}
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "password", "http://auth0.com/oauth/grant-type/password-realm":
+		if grantType != "password" && (s.Connection == "" || r.PostForm.Get("realm") != s.Connection) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Unknown realm")
+			return
+		}
+
+		s.mu.Lock()
+		user := s.findByUsername(r.PostForm.Get("username"))
+		if user == nil || user.Password != r.PostForm.Get("password") {
+			s.mu.Unlock()
+			writeOAuthError(w, http.StatusForbidden, "invalid_grant", "Wrong email or password.")
+			return
+		}
+		session := &oidcSession{userID: user.ID, audience: r.PostForm.Get("audience")}
+		if session.audience == "" {
+			session.audience = s.ClientID
+		}
+		sessionID := uuid.New().String()
+		s.sessions[sessionID] = session
+		refreshToken := randomToken()
+		s.refreshTokens[refreshToken] = sessionID
+		s.mu.Unlock()
+
+		s.writeTokens(w, user, sessionID, refreshToken, session.audience)
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+
+		s.mu.Lock()
+		sessionID := s.refreshTokens[refreshToken]
+		session := s.sessions[sessionID]
+		var user *User
+		if session != nil {
+			user = s.users[session.userID]
+		}
+		s.mu.Unlock()
+		if user == nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Unknown or invalid refresh token.")
+			return
+		}
+
+		s.writeTokens(w, user, sessionID, refreshToken, session.audience)
+	case "client_credentials":
+		audience := r.PostForm.Get("audience")
+		if audience == "" {
+			audience = s.ClientID
+		}
+
+		token, err := s.sign(jwt.MapClaims{
+			"sub": s.ClientID + "@clients",
+			"aud": audience,
+			"azp": s.ClientID,
+		})
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int64(tokenTTL.Seconds()),
+		})
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+}
+
+func (s *OIDCServer) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	user := s.userOf(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if user == nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "Invalid token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":                user.ID,
+		"preferred_username": user.Username,
+		"email":              user.Email,
+	})
+}
+
+func (s *OIDCServer) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if !s.clientAuthenticated(w, r) {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	user := s.userOf(token)
+	if user == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+
+	claims, _ := s.parse(token)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"active":    true,
+		"sub":       user.ID,
+		"username":  user.Username,
+		"email":     user.Email,
+		"client_id": s.ClientID,
+		"exp":       claims["exp"],
+	})
+}
+
+func (s *OIDCServer) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if !s.clientAuthenticated(w, r) {
+		return
+	}
+
+	// Revoking a refresh token ends its session; unknown tokens are ignored
+	// as RFC 7009 requires
+	s.mu.Lock()
+	if sessionID, ok := s.refreshTokens[r.PostForm.Get("token")]; ok {
+		delete(s.sessions, sessionID)
+		delete(s.refreshTokens, r.PostForm.Get("token"))
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// clientAuthenticated checks the client credentials sent with HTTP basic
+// authentication or posted with the form
+func (s *OIDCServer) clientAuthenticated(w http.ResponseWriter, r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return false
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return false
+	}
+	return true
+}
+
+// writeTokens issues an access token for a user session, together with its
+// refresh token
+func (s *OIDCServer) writeTokens(w http.ResponseWriter, user *User, sessionID, refreshToken, audience string) {
+	s.mu.Lock()
+	username, email := user.Username, user.Email
+	s.mu.Unlock()
+
+	accessToken, err := s.sign(jwt.MapClaims{
+		"sub":                user.ID,
+		"aud":                audience,
+		"azp":                s.ClientID,
+		"sid":                sessionID,
+		"preferred_username": username,
+		"email":              email,
+	})
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int64(tokenTTL.Seconds()),
+		"scope":         "openid profile email offline_access",
+	})
+}
+
+// userOf returns the user of a valid access token whose session is active, or nil
+func (s *OIDCServer) userOf(token string) *User {
+	claims, err := s.parse(token)
+	if err != nil {
+		return nil
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := s.sessions[sessionID]
+	if session == nil {
+		return nil
+	}
+	return s.users[session.userID]
+}
+
+// sign signs a token issued by the fake
+func (s *OIDCServer) sign(claims jwt.MapClaims) (string, error) {
+	return signToken(s.Issuer, claims)
+}
+
+// parse verifies a token issued by the fake
+func (s *OIDCServer) parse(token string) (jwt.MapClaims, error) {
+	return parseToken(s.Issuer, token)
+}
+
+// findByUsername returns the user with the given username; callers must hold the lock
+func (s *OIDCServer) findByUsername(username string) *User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+// roleName returns the name of the role with the given ID, or an empty string
+// when there is none; callers must hold the lock
+func (s *OIDCServer) roleName(id string) string {
+	for name, roleID := range s.roles {
+		if roleID == id {
+			return name
+		}
+	}
+	return ""
+}
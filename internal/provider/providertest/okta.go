@@ -0,0 +1,244 @@
+package providertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// OktaServer is an in-memory fake of an Okta org used by
+// provider.OktaProvider: the OAuth endpoints of the org authorization server,
+// served by the embedded OIDCServer, and the Management API for users and
+// groups, authenticated with an SSWS API token. Roles are served as groups.
+type OktaServer struct {
+	*OIDCServer
+
+	// APIToken authenticates Management API requests
+	APIToken string
+	// PageSize is how many groups are listed per page. It defaults to 200,
+	// Okta's default limit.
+	PageSize int
+}
+
+// oktaErrorBody is the error body of the Management API
+type oktaErrorBody struct {
+	ErrorCode    string            `json:"errorCode"`
+	ErrorSummary string            `json:"errorSummary"`
+	ErrorCauses  []oktaErrorReason `json:"errorCauses,omitempty"`
+}
+
+// oktaErrorReason is a cause listed in an error body
+type oktaErrorReason struct {
+	ErrorSummary string `json:"errorSummary"`
+}
+
+// NewOktaServer starts a fake Okta org without users or groups. The server is
+// closed when the test finishes.
+func NewOktaServer(t testing.TB) *OktaServer {
+	t.Helper()
+
+	s := &OktaServer{
+		APIToken: "providertest-api-token",
+		PageSize: 200,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/users/{id}", s.management(s.handleGetUser))
+	mux.HandleFunc("POST /api/v1/users/{id}", s.management(s.handleUpdateUser))
+	mux.HandleFunc("GET /api/v1/users/{id}/groups", s.management(s.handleGetUserGroups))
+	mux.HandleFunc("GET /api/v1/groups", s.management(s.handleListGroups))
+	mux.HandleFunc("PUT /api/v1/groups/{groupID}/users/{id}", s.management(s.handleModifyMembership))
+	mux.HandleFunc("DELETE /api/v1/groups/{groupID}/users/{id}", s.management(s.handleModifyMembership))
+
+	s.OIDCServer = newOIDCServer(t, mux)
+	s.userIDPrefix = "00u"
+	s.roleIDPrefix = "00g"
+
+	return s
+}
+
+// Config returns an Okta configuration pointing at the fake, using the org
+// authorization server
+func (s *OktaServer) Config() config.OktaConfig {
+	return config.OktaConfig{
+		OrgURL:       s.URL,
+		ClientID:     s.ClientID,
+		ClientSecret: config.Secret(s.ClientSecret),
+		Management: config.OktaManagementConfig{
+			APIToken: config.Secret(s.APIToken),
+		},
+	}
+}
+
+func (s *OktaServer) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeOktaNotFound(w, r.PathValue("id"), "User")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, oktaUserRepresentation(user))
+}
+
+func (s *OktaServer) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Profile map[string]string `json:"profile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, oktaErrorBody{
+			ErrorCode:    "E0000003",
+			ErrorSummary: "The request body was not well-formed.",
+		})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeOktaNotFound(w, r.PathValue("id"), "User")
+		return
+	}
+
+	login := body.Profile["login"]
+	if login != "" {
+		for _, other := range s.users {
+			if other != user && strings.EqualFold(other.Username, login) {
+				writeJSON(w, http.StatusBadRequest, oktaErrorBody{
+					ErrorCode:    "E0000001",
+					ErrorSummary: "Api validation failed: login",
+					ErrorCauses: []oktaErrorReason{{
+						ErrorSummary: "login: An object with this field already exists in the current organization",
+					}},
+				})
+				return
+			}
+		}
+		user.Username = login
+	}
+	if email := body.Profile["email"]; email != "" {
+		user.Email = email
+	}
+
+	writeJSON(w, http.StatusOK, oktaUserRepresentation(user))
+}
+
+func (s *OktaServer) handleGetUserGroups(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeOktaNotFound(w, r.PathValue("id"), "User")
+		return
+	}
+
+	s.writeGroupPage(w, r, append([]string{}, user.Roles...))
+}
+
+func (s *OktaServer) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// q is a case-insensitive prefix search on the group name
+	q := strings.ToLower(r.URL.Query().Get("q"))
+	var names []string
+	for name := range s.roles {
+		if strings.HasPrefix(strings.ToLower(name), q) {
+			names = append(names, name)
+		}
+	}
+
+	s.writeGroupPage(w, r, names)
+}
+
+func (s *OktaServer) handleModifyMembership(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group := s.roleName(r.PathValue("groupID"))
+	if group == "" {
+		writeOktaNotFound(w, r.PathValue("groupID"), "UserGroup")
+		return
+	}
+
+	user := s.users[r.PathValue("id")]
+	if user == nil {
+		writeOktaNotFound(w, r.PathValue("id"), "User")
+		return
+	}
+
+	user.Roles = setRole(user.Roles, group, r.Method == http.MethodPut)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeGroupPage writes the page of the named groups starting at the after
+// cursor, with a Link header to the next page when there is one. Callers
+// must hold the lock.
+func (s *OktaServer) writeGroupPage(w http.ResponseWriter, r *http.Request, names []string) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("after"))
+	names, next := paginate(names, start, s.PageSize)
+
+	if next > 0 {
+		query := r.URL.Query()
+		query.Set("after", strconv.Itoa(next))
+		link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="next"`, s.URL, link.String()))
+	}
+
+	page := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		page = append(page, map[string]interface{}{
+			"id":      s.roles[name],
+			"profile": map[string]string{"name": name},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// management wraps a Management API handler, requiring the SSWS API token
+func (s *OktaServer) management(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "SSWS "+s.APIToken {
+			writeJSON(w, http.StatusUnauthorized, oktaErrorBody{
+				ErrorCode:    "E0000011",
+				ErrorSummary: "Invalid token provided",
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// oktaUserRepresentation builds an Okta user object
+func oktaUserRepresentation(user *User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     user.ID,
+		"status": "ACTIVE",
+		"profile": map[string]string{
+			"login": user.Username,
+			"email": user.Email,
+		},
+	}
+}
+
+// writeOktaNotFound writes the Management API error for an unknown resource
+func writeOktaNotFound(w http.ResponseWriter, id, kind string) {
+	writeJSON(w, http.StatusNotFound, oktaErrorBody{
+		ErrorCode:    "E0000007",
+		ErrorSummary: fmt.Sprintf("Not found: Resource not found: %s (%s)", id, kind),
+	})
+}
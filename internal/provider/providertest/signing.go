@@ -0,0 +1,91 @@
+package providertest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// signingKeyID is the kid of the key every fake signs its tokens with
+	signingKeyID = "providertest"
+	// tokenTTL is the lifetime of every token issued by the fakes
+	tokenTTL = 5 * time.Minute
+)
+
+var (
+	signingKeyOnce sync.Once
+	sharedKey      *rsa.PrivateKey
+)
+
+// signingKey returns the RSA key shared by all fakes, as key generation is slow
+func signingKey() *rsa.PrivateKey {
+	signingKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(fmt.Sprintf("failed to generate RSA key: %v", err))
+		}
+		sharedKey = key
+	})
+	return sharedKey
+}
+
+// jwks builds the JSON Web Key Set publishing the public half of the shared key
+func jwks() map[string]interface{} {
+	public := signingKey().PublicKey
+	return map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": signingKeyID,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	}
+}
+
+// signToken adds the issuer and the standard time and ID claims, and signs a
+// token with the shared key
+func signToken(issuer string, claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims["iss"] = issuer
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(tokenTTL).Unix()
+	claims["jti"] = uuid.New().String()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = signingKeyID
+	return token.SignedString(signingKey())
+}
+
+// parseToken verifies a token signed by signToken for issuer
+func parseToken(issuer, token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return &signingKey().PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(issuer),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// randomToken returns an opaque random token
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate token: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
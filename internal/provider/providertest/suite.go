@@ -0,0 +1,439 @@
+// Package providertest provides a conformance suite for provider.IAMProvider
+// implementations, and in-memory fakes of external IdPs to run it against.
+package providertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+)
+
+// Fixture is a provider under test together with the data it was seeded with
+type Fixture struct {
+	Provider provider.IAMProvider
+	// UserID, Username and Password identify an existing user
+	UserID   string
+	Username string
+	Password string
+	// Role is an existing role that the user does not hold
+	Role string
+	// OtherUsername is the username of a second existing user. Cases that
+	// check username conflicts are skipped when it is empty.
+	OtherUsername string
+	// Context is passed to every provider call, e.g. to carry a tenant. It
+	// defaults to context.Background().
+	Context context.Context
+}
+
+// unknownID is a user ID no fixture is expected to contain
+const unknownID = "00000000-0000-0000-0000-00000000dead"
+
+// User is a user of a fake IdP
+type User struct {
+	// ID is generated by AddUser when empty
+	ID       string
+	Username string
+	Email    string
+	Password string
+	// Roles are the names of the user's roles or groups, which must have
+	// been created with AddRole
+	Roles []string
+	// EmailVerified is reported by fakes whose APIs expose it
+	EmailVerified bool
+}
+
+// Backend is a fake IdP that fixtures can be seeded into
+type Backend interface {
+	// AddRole creates a role, or a group for IdPs that map roles to groups
+	AddRole(name string)
+	// AddUser creates a user and returns it as stored
+	AddUser(user User) *User
+}
+
+// Seed adds the data of a standard fixture to a fake: the roles "users:read"
+// and "users:admin", alice holding "users:read", and bob. It returns the
+// fixture for alice, without a provider.
+func Seed(b Backend) *Fixture {
+	b.AddRole("users:read")
+	b.AddRole("users:admin")
+	alice := b.AddUser(User{
+		Username: "alice",
+		Email:    "alice@example.com",
+		Password: "alice-password",
+		Roles:    []string{"users:read"},
+	})
+	bob := b.AddUser(User{
+		Username: "bob",
+		Email:    "bob@example.com",
+		Password: "bob-password",
+	})
+
+	return &Fixture{
+		UserID:        alice.ID,
+		Username:      alice.Username,
+		Password:      alice.Password,
+		Role:          "users:admin",
+		OtherUsername: bob.Username,
+	}
+}
+
+// testCase is a single conformance check run against a fresh fixture
+type testCase struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, f *Fixture)
+}
+
+// Run runs the conformance suite against the fixtures returned by newFixture.
+// A fresh fixture is created for every case, so cases can modify users and
+// roles freely. Cases for operations the provider reports as
+// provider.ErrUnsupportedOperation are skipped.
+func Run(t *testing.T, newFixture func(t *testing.T) *Fixture) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			ctx := f.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			tc.run(t, ctx, f)
+		})
+	}
+}
+
+var cases = []testCase{
+	{
+		name: "Login/ValidCredentials",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			tokens := login(t, ctx, f)
+			if tokens.AccessToken == "" {
+				t.Error("Login returned an empty access token")
+			}
+		},
+	},
+	{
+		name: "Login/WrongPassword",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			_, err := f.Provider.Login(ctx, f.Username, f.Password+"-wrong")
+			expectError(t, "Login", err, provider.ErrInvalidCredentials)
+		},
+	},
+	{
+		name: "Login/UnknownUser",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			_, err := f.Provider.Login(ctx, "unknown-"+f.Username, f.Password)
+			expectError(t, "Login", err, provider.ErrInvalidCredentials)
+		},
+	},
+	{
+		name: "ValidateToken/Valid",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			tokens := login(t, ctx, f)
+
+			info, err := f.Provider.ValidateToken(ctx, tokens.AccessToken)
+			requireNoError(t, "ValidateToken", err)
+			if info.UserID != f.UserID {
+				t.Errorf("ValidateToken returned user ID %q, want %q", info.UserID, f.UserID)
+			}
+			if !strings.EqualFold(info.Username, f.Username) {
+				t.Errorf("ValidateToken returned username %q, want %q", info.Username, f.Username)
+			}
+		},
+	},
+	{
+		name: "ValidateToken/Malformed",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			_, err := f.Provider.ValidateToken(ctx, "not-a-token")
+			expectError(t, "ValidateToken", err, provider.ErrTokenInvalid)
+		},
+	},
+	{
+		name: "ValidateToken/TamperedSignature",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			tokens := login(t, ctx, f)
+
+			_, err := f.Provider.ValidateToken(ctx, tamper(tokens.AccessToken))
+			expectError(t, "ValidateToken", err, provider.ErrTokenInvalid)
+		},
+	},
+	{
+		name: "RefreshToken/Valid",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			tokens := login(t, ctx, f)
+
+			refreshed, err := f.Provider.RefreshToken(ctx, tokens.RefreshToken)
+			skipIfUnsupported(t, err)
+			requireNoError(t, "RefreshToken", err)
+			if refreshed.AccessToken == "" {
+				t.Fatal("RefreshToken returned an empty access token")
+			}
+
+			info, err := f.Provider.ValidateToken(ctx, refreshed.AccessToken)
+			requireNoError(t, "ValidateToken", err)
+			if info.UserID != f.UserID {
+				t.Errorf("refreshed token has user ID %q, want %q", info.UserID, f.UserID)
+			}
+		},
+	},
+	{
+		name: "RefreshToken/Malformed",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			_, err := f.Provider.RefreshToken(ctx, "not-a-token")
+			skipIfUnsupported(t, err)
+			expectError(t, "RefreshToken", err, provider.ErrTokenInvalid, provider.ErrTokenExpired)
+		},
+	},
+	{
+		name: "Logout/RevokesRefreshToken",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			tokens := login(t, ctx, f)
+
+			err := f.Provider.Logout(ctx, tokens.RefreshToken)
+			skipIfUnsupported(t, err)
+			requireNoError(t, "Logout", err)
+
+			_, err = f.Provider.RefreshToken(ctx, tokens.RefreshToken)
+			expectError(t, "RefreshToken after Logout", err, provider.ErrTokenInvalid, provider.ErrTokenExpired)
+		},
+	},
+	{
+		name: "GetUserInfo/Existing",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			info, err := f.Provider.GetUserInfo(ctx, f.UserID)
+			skipIfUnsupported(t, err)
+			requireNoError(t, "GetUserInfo", err)
+			if info.ID != f.UserID {
+				t.Errorf("GetUserInfo returned ID %q, want %q", info.ID, f.UserID)
+			}
+			if !strings.EqualFold(info.UserName, f.Username) {
+				t.Errorf("GetUserInfo returned username %q, want %q", info.UserName, f.Username)
+			}
+		},
+	},
+	{
+		name: "GetUserInfo/UnknownUser",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			_, err := f.Provider.GetUserInfo(ctx, unknownID)
+			skipIfUnsupported(t, err)
+			expectError(t, "GetUserInfo", err, provider.ErrUserNotFound)
+		},
+	},
+	{
+		name: "UpdateUserInfo/PartialUpdate",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			email := "updated-" + strings.ToLower(f.Username) + "@example.com"
+
+			err := f.Provider.UpdateUserInfo(ctx, f.UserID, &provider.UserInfo{Email: email})
+			skipIfUnsupported(t, err)
+			requireNoError(t, "UpdateUserInfo", err)
+
+			info, err := f.Provider.GetUserInfo(ctx, f.UserID)
+			requireNoError(t, "GetUserInfo", err)
+			if info.Email != email {
+				t.Errorf("email is %q after update, want %q", info.Email, email)
+			}
+			if !strings.EqualFold(info.UserName, f.Username) {
+				t.Errorf("username changed to %q by an email-only update", info.UserName)
+			}
+		},
+	},
+	{
+		name: "UpdateUserInfo/UnknownUser",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			err := f.Provider.UpdateUserInfo(ctx, unknownID, &provider.UserInfo{Email: "unknown@example.com"})
+			skipIfUnsupported(t, err)
+			expectError(t, "UpdateUserInfo", err, provider.ErrUserNotFound)
+		},
+	},
+	{
+		name: "UpdateUserInfo/UsernameConflict",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			if f.OtherUsername == "" {
+				t.Skip("fixture has no second user")
+			}
+
+			err := f.Provider.UpdateUserInfo(ctx, f.UserID, &provider.UserInfo{UserName: f.OtherUsername})
+			skipIfUnsupported(t, err)
+			expectError(t, "UpdateUserInfo", err, provider.ErrUserConflict)
+		},
+	},
+	{
+		name: "Roles/AssignAndRemove",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			err := f.Provider.AssignRole(ctx, f.UserID, f.Role)
+			skipIfUnsupported(t, err)
+			requireNoError(t, "AssignRole", err)
+
+			roles, err := f.Provider.GetUserRoles(ctx, f.UserID)
+			requireNoError(t, "GetUserRoles", err)
+			if !contains(roles, f.Role) {
+				t.Fatalf("GetUserRoles returned %v after AssignRole, want it to contain %q", roles, f.Role)
+			}
+
+			requireNoError(t, "RemoveRole", f.Provider.RemoveRole(ctx, f.UserID, f.Role))
+
+			roles, err = f.Provider.GetUserRoles(ctx, f.UserID)
+			requireNoError(t, "GetUserRoles", err)
+			if contains(roles, f.Role) {
+				t.Errorf("GetUserRoles returned %v after RemoveRole, want it without %q", roles, f.Role)
+			}
+		},
+	},
+	{
+		name: "Roles/UnknownRole",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			err := f.Provider.AssignRole(ctx, f.UserID, "unknown-role")
+			skipIfUnsupported(t, err)
+			expectError(t, "AssignRole", err, provider.ErrRoleNotFound)
+
+			err = f.Provider.RemoveRole(ctx, f.UserID, "unknown-role")
+			expectError(t, "RemoveRole", err, provider.ErrRoleNotFound)
+		},
+	},
+	{
+		name: "Roles/UnknownUser",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			err := f.Provider.AssignRole(ctx, unknownID, f.Role)
+			skipIfUnsupported(t, err)
+			expectError(t, "AssignRole", err, provider.ErrUserNotFound)
+
+			_, err = f.Provider.GetUserRoles(ctx, unknownID)
+			expectError(t, "GetUserRoles", err, provider.ErrUserNotFound)
+		},
+	},
+	{
+		name: "HealthCheck",
+		run: func(t *testing.T, ctx context.Context, f *Fixture) {
+			requireNoError(t, "HealthCheck", f.Provider.HealthCheck(ctx))
+		},
+	},
+}
+
+// login signs in as the fixture user and fails the test on error
+func login(t *testing.T, ctx context.Context, f *Fixture) *provider.TokenSet {
+	t.Helper()
+
+	tokens, err := f.Provider.Login(ctx, f.Username, f.Password)
+	requireNoError(t, "Login", err)
+	return tokens
+}
+
+// tamper flips a character in the middle of the token's signature. The last
+// character is avoided as it may only carry base64 padding bits.
+func tamper(token string) string {
+	if token == "" {
+		return "x"
+	}
+
+	start := strings.LastIndex(token, ".") + 1
+	i := start + (len(token)-start)/2
+	replacement := byte('A')
+	if token[i] == 'A' {
+		replacement = 'B'
+	}
+	return token[:i] + string(replacement) + token[i+1:]
+}
+
+// skipIfUnsupported skips the test when the provider does not support the operation
+func skipIfUnsupported(t *testing.T, err error) {
+	t.Helper()
+
+	if errors.Is(err, provider.ErrUnsupportedOperation) {
+		t.Skipf("provider does not support the operation: %v", err)
+	}
+}
+
+// requireNoError stops the test when err is not nil
+func requireNoError(t *testing.T, op string, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s returned unexpected error: %v", op, err)
+	}
+}
+
+// expectError checks that err matches one of targets
+func expectError(t *testing.T, op string, err error, targets ...error) {
+	t.Helper()
+
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return
+		}
+	}
+	t.Errorf("%s returned error %v, want one of %v", op, err, targets)
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// startServer serves handler over HTTP until the test finishes
+func startServer(t testing.TB, handler http.Handler) *httptest.Server {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeJSON writes value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeOAuthError writes an OAuth 2.0 error response
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// paginate sorts names and returns the page of at most size names starting at
+// offset start, and the offset of the next page, which is 0 after the last page
+func paginate(names []string, start, size int) ([]string, int) {
+	sort.Strings(names)
+
+	start = min(max(start, 0), len(names))
+	end := min(start+size, len(names))
+	if end == len(names) {
+		return names[start:end], 0
+	}
+	return names[start:end], end
+}
+
+// setRole adds role to roles when member is set and removes it otherwise
+func setRole(roles []string, role string, member bool) []string {
+	updated := roles[:0]
+	for _, existing := range roles {
+		if existing != role {
+			updated = append(updated, existing)
+		}
+	}
+	if member {
+		updated = append(updated, role)
+	}
+	return updated
+}
+
+// newID returns prefix followed by n random hex digits, mimicking the
+// resource IDs of IdPs that do not use UUIDs
+func newID(prefix string, n int) string {
+	return prefix + strings.ReplaceAll(uuid.New().String(), "-", "")[:n]
+}
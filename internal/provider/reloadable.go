@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// providerGeneration is one provider installed in a ReloadableProvider,
+// together with the calls still running against it
+type providerGeneration struct {
+	provider IAMProvider
+
+	mu      sync.Mutex
+	active  int
+	retired bool
+	// drained is closed once the generation is retired and idle
+	drained chan struct{}
+}
+
+// ReloadableProvider implements IAMProvider by delegating to a provider that
+// can be replaced at runtime. Calls in flight during a swap finish on the
+// provider they started on, which is closed once the last of them returns.
+type ReloadableProvider struct {
+	current atomic.Pointer[providerGeneration]
+}
+
+// NewReloadableProvider creates a ReloadableProvider delegating to p
+func NewReloadableProvider(p IAMProvider) *ReloadableProvider {
+	r := &ReloadableProvider{}
+	r.current.Store(newProviderGeneration(p))
+	return r
+}
+
+// Swap installs p for all new calls. The previous provider is closed, if it
+// has a Close method, after its in-flight calls have returned.
+func (r *ReloadableProvider) Swap(p IAMProvider) {
+	previous := r.current.Swap(newProviderGeneration(p))
+	previous.retire()
+
+	go func() {
+		<-previous.drained
+		_ = closeProvider(previous.provider)
+	}()
+}
+
+// Current returns the provider new calls are delegated to
+func (r *ReloadableProvider) Current() IAMProvider {
+	return r.current.Load().provider
+}
+
+// Close closes the current provider, if it has a Close method
+func (r *ReloadableProvider) Close() error {
+	return closeProvider(r.Current())
+}
+
+// Login delegates to the current provider
+func (r *ReloadableProvider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.Login(ctx, username, password)
+}
+
+// Logout delegates to the current provider
+func (r *ReloadableProvider) Logout(ctx context.Context, token string) error {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.Logout(ctx, token)
+}
+
+// ValidateToken delegates to the current provider
+func (r *ReloadableProvider) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.ValidateToken(ctx, token)
+}
+
+// RefreshToken delegates to the current provider
+func (r *ReloadableProvider) RefreshToken(ctx context.Context, token string) (*TokenSet, error) {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.RefreshToken(ctx, token)
+}
+
+// GetUserInfo delegates to the current provider
+func (r *ReloadableProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.GetUserInfo(ctx, userID)
+}
+
+// UpdateUserInfo delegates to the current provider
+func (r *ReloadableProvider) UpdateUserInfo(ctx context.Context, userID string, userInfo *UserInfo) error {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.UpdateUserInfo(ctx, userID, userInfo)
+}
+
+// AssignRole delegates to the current provider
+func (r *ReloadableProvider) AssignRole(ctx context.Context, userID, role string) error {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.AssignRole(ctx, userID, role)
+}
+
+// RemoveRole delegates to the current provider
+func (r *ReloadableProvider) RemoveRole(ctx context.Context, userID, role string) error {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.RemoveRole(ctx, userID, role)
+}
+
+// GetUserRoles delegates to the current provider
+func (r *ReloadableProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.GetUserRoles(ctx, userID)
+}
+
+// HealthCheck delegates to the current provider
+func (r *ReloadableProvider) HealthCheck(ctx context.Context) error {
+	g := r.acquire()
+	defer g.release()
+	return g.provider.HealthCheck(ctx)
+}
+
+// acquire registers a call on the current generation. A generation retired
+// between loading and registering is skipped for the one that replaced it.
+func (r *ReloadableProvider) acquire() *providerGeneration {
+	for {
+		g := r.current.Load()
+
+		g.mu.Lock()
+		if !g.retired {
+			g.active++
+			g.mu.Unlock()
+			return g
+		}
+		g.mu.Unlock()
+	}
+}
+
+// newProviderGeneration wraps p in a new generation
+func newProviderGeneration(p IAMProvider) *providerGeneration {
+	return &providerGeneration{
+		provider: p,
+		drained:  make(chan struct{}),
+	}
+}
+
+// release marks a call on the generation as finished
+func (g *providerGeneration) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.active--
+	if g.retired && g.active == 0 {
+		close(g.drained)
+	}
+}
+
+// retire stops the generation from accepting new calls
+func (g *providerGeneration) retire() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.retired = true
+	if g.active == 0 {
+		close(g.drained)
+	}
+}
+
+// closeProvider closes p if it holds resources
+func closeProvider(p IAMProvider) error {
+	if closer, ok := p.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
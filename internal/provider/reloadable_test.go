@@ -0,0 +1,76 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+)
+
+// blockingProvider is an IAMProvider whose health check blocks until released
+type blockingProvider struct {
+	provider.IAMProvider
+	started chan struct{}
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (p *blockingProvider) HealthCheck(ctx context.Context) error {
+	p.started <- struct{}{}
+	<-p.release
+	return nil
+}
+
+func (p *blockingProvider) Close() error {
+	close(p.closed)
+	return nil
+}
+
+func TestReloadableProviderSwapWaitsForInFlightCalls(t *testing.T) {
+	previous := newBlockingProvider()
+	next := newBlockingProvider()
+	r := provider.NewReloadableProvider(previous)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.HealthCheck(context.Background())
+	}()
+	<-previous.started
+
+	r.Swap(next)
+	if r.Current() != next {
+		t.Fatal("Current does not return the swapped in provider")
+	}
+
+	select {
+	case <-previous.closed:
+		t.Fatal("previous provider was closed while a call was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(previous.release)
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight call returned unexpected error: %v", err)
+	}
+
+	select {
+	case <-previous.closed:
+	case <-time.After(time.Second):
+		t.Fatal("previous provider was not closed after its calls returned")
+	}
+
+	close(next.release)
+	if err := r.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck returned unexpected error: %v", err)
+	}
+	<-next.started
+}
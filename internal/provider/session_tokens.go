@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+const (
+	// sessionTokenUseAccess marks access tokens issued by the bridge
+	sessionTokenUseAccess = "access"
+	// sessionTokenUseRefresh marks refresh tokens issued by the bridge
+	sessionTokenUseRefresh = "refresh"
+)
+
+// sessionSubject is the user a session token set is issued for
+type sessionSubject struct {
+	ID       string
+	Username string
+	Email    string
+	Roles    []string
+}
+
+// sessionIssuer issues and verifies tokens signed by the bridge itself, for
+// providers such as LDAP that have no token service. Claims follow the same
+// shape as Keycloak tokens so tokenInfoFromClaims can read them.
+//
+// Revocations are kept in memory and are therefore local to one instance.
+type sessionIssuer struct {
+	key        []byte
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// newSessionIssuer creates a session issuer, applying defaults for unset TTLs
+func newSessionIssuer(cfg *config.SessionTokenConfig, defaultIssuer string) (*sessionIssuer, error) {
+	if len(cfg.SigningKey) < config.MinSessionSigningKeyLength {
+		return nil, fmt.Errorf("session signing key must be at least %d bytes", config.MinSessionSigningKeyLength)
+	}
+
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = defaultIssuer
+	}
+
+	accessTTL := cfg.AccessTokenTTL
+	if accessTTL <= 0 {
+		accessTTL = 5 * time.Minute
+	}
+
+	refreshTTL := cfg.RefreshTokenTTL
+	if refreshTTL <= 0 {
+		refreshTTL = 30 * time.Minute
+	}
+
+	return &sessionIssuer{
+		key:        []byte(cfg.SigningKey.Value()),
+		issuer:     issuer,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		revoked:    make(map[string]time.Time),
+	}, nil
+}
+
+// Issue signs a new access and refresh token pair for the subject
+func (s *sessionIssuer) Issue(subject *sessionSubject) (*TokenSet, error) {
+	now := time.Now()
+
+	roles := subject.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	accessToken, err := s.sign(jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                subject.ID,
+		"aud":                s.issuer,
+		"iat":                now.Unix(),
+		"nbf":                now.Unix(),
+		"exp":                now.Add(s.accessTTL).Unix(),
+		"jti":                uuid.New().String(),
+		"token_use":          sessionTokenUseAccess,
+		"preferred_username": subject.Username,
+		"email":              subject.Email,
+		"realm_access":       map[string]interface{}{"roles": roles},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.sign(jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                subject.ID,
+		"aud":                s.issuer,
+		"iat":                now.Unix(),
+		"nbf":                now.Unix(),
+		"exp":                now.Add(s.refreshTTL).Unix(),
+		"jti":                uuid.New().String(),
+		"token_use":          sessionTokenUseRefresh,
+		"preferred_username": subject.Username,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenSet{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.accessTTL.Seconds()),
+		RefreshExpiresIn: int64(s.refreshTTL.Seconds()),
+	}, nil
+}
+
+// Validate verifies a token of the given use and returns its claims
+func (s *sessionIssuer) Validate(token, use string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+
+	if tokenUse, _ := claims["token_use"].(string); tokenUse != use {
+		return nil, fmt.Errorf("%w: not an %s token", ErrTokenInvalid, use)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if s.isRevoked(jti) {
+		return nil, fmt.Errorf("%w: token has been revoked", ErrTokenInvalid)
+	}
+
+	return claims, nil
+}
+
+// Revoke invalidates an access or refresh token until it expires
+func (s *sessionIssuer) Revoke(token string) error {
+	claims, err := s.Validate(token, sessionTokenUseRefresh)
+	if err != nil {
+		claims, err = s.Validate(token, sessionTokenUseAccess)
+		if err != nil {
+			return err
+		}
+	}
+
+	jti, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return ErrTokenInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop entries for tokens that have expired on their own
+	now := time.Now()
+	for id, expiry := range s.revoked {
+		if expiry.Before(now) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[jti] = expiresAt.Time
+
+	return nil
+}
+
+// isRevoked reports whether the token with the given ID has been revoked
+func (s *sessionIssuer) isRevoked(jti string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, revoked := s.revoked[jti]
+	return revoked
+}
+
+// sign serializes and signs the claims with HS256
+func (s *sessionIssuer) sign(claims jwt.MapClaims) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign session token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,463 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// staticUserNamespace is the UUID namespace of the IDs derived from the
+// usernames of inline users without an ID
+var staticUserNamespace = uuid.MustParse("5b0f6d1e-8f3c-4c55-9a87-2f1e4d6b7c90")
+
+// staticUser is a user record of the static provider
+type staticUser struct {
+	ID           string   `json:"id" yaml:"id"`
+	Username     string   `json:"username" yaml:"username"`
+	Email        string   `json:"email,omitempty" yaml:"email,omitempty"`
+	PasswordHash string   `json:"password_hash" yaml:"password_hash"`
+	Roles        []string `json:"roles" yaml:"roles"`
+}
+
+// staticStore is the content of a static provider users file
+type staticStore struct {
+	// Roles is the catalog of roles that can be assigned
+	Roles []string      `json:"roles" yaml:"roles"`
+	Users []*staticUser `json:"users" yaml:"users"`
+}
+
+// StaticProvider implements IAMProvider with users kept in memory, optionally
+// loaded from and persisted to a YAML or JSON file. It signs its own session
+// tokens and needs no external IdP, which makes it suitable for local
+// development and CI.
+type StaticProvider struct {
+	config   *config.StaticConfig
+	sessions *sessionIssuer
+	// dummyHash is compared against when a login names an unknown user, so
+	// unknown users and wrong passwords take the same time to reject
+	dummyHash []byte
+
+	mu    sync.RWMutex
+	store *staticStore
+}
+
+// Login checks the password against the user's bcrypt hash and issues a session token set
+func (s *StaticProvider) Login(ctx context.Context, username, password string) (*TokenSet, error) {
+	s.mu.RLock()
+	user := s.findByUsername(username)
+	var subject *sessionSubject
+	hash := s.dummyHash
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+		subject = user.subject()
+	}
+	s.mu.RUnlock()
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || user == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.sessions.Issue(subject)
+}
+
+// Logout revokes the provided session token
+func (s *StaticProvider) Logout(ctx context.Context, token string) error {
+	return s.sessions.Revoke(token)
+}
+
+// ValidateToken verifies a session access token issued by the provider
+func (s *StaticProvider) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	claims, err := s.sessions.Validate(token, sessionTokenUseAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenInfoFromClaims(claims), nil
+}
+
+// RefreshToken issues a new session token set for a valid refresh token with
+// the user's current roles, and revokes the old refresh token
+func (s *StaticProvider) RefreshToken(ctx context.Context, refreshToken string) (*TokenSet, error) {
+	claims, err := s.sessions.Validate(refreshToken, sessionTokenUseRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, _ := claims["sub"].(string)
+
+	s.mu.RLock()
+	user := s.findByID(userID)
+	var subject *sessionSubject
+	if user != nil {
+		subject = user.subject()
+	}
+	s.mu.RUnlock()
+
+	if subject == nil {
+		return nil, ErrTokenInvalid
+	}
+
+	if err := s.sessions.Revoke(refreshToken); err != nil {
+		return nil, err
+	}
+
+	return s.sessions.Issue(subject)
+}
+
+// GetUserInfo retrieves user information
+func (s *StaticProvider) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return &UserInfo{
+		ID:       user.ID,
+		UserName: user.Username,
+		Email:    user.Email,
+		Roles:    append([]string{}, user.Roles...),
+	}, nil
+}
+
+// UpdateUserInfo applies the non-empty fields of info to a user. Usernames and
+// emails must stay unique.
+func (s *StaticProvider) UpdateUserInfo(ctx context.Context, userID string, info *UserInfo) error {
+	return s.modify(func() error {
+		user := s.findByID(userID)
+		if user == nil {
+			return ErrUserNotFound
+		}
+
+		for _, other := range s.store.Users {
+			if other == user {
+				continue
+			}
+			if info.UserName != "" && strings.EqualFold(other.Username, info.UserName) {
+				return fmt.Errorf("%w: username %q is taken", ErrUserConflict, info.UserName)
+			}
+			if info.Email != "" && strings.EqualFold(other.Email, info.Email) {
+				return fmt.Errorf("%w: email %q is taken", ErrUserConflict, info.Email)
+			}
+		}
+
+		if info.UserName != "" {
+			user.Username = info.UserName
+		}
+		if info.Email != "" {
+			user.Email = info.Email
+		}
+		return nil
+	})
+}
+
+// AssignRole grants a role from the role catalog to a user
+func (s *StaticProvider) AssignRole(ctx context.Context, userID string, role string) error {
+	return s.modify(func() error {
+		user := s.findByID(userID)
+		if user == nil {
+			return ErrUserNotFound
+		}
+		if !s.roleExists(role) {
+			return ErrRoleNotFound
+		}
+
+		for _, existing := range user.Roles {
+			if existing == role {
+				return nil
+			}
+		}
+		user.Roles = append(user.Roles, role)
+		return nil
+	})
+}
+
+// RemoveRole revokes a role from a user
+func (s *StaticProvider) RemoveRole(ctx context.Context, userID string, role string) error {
+	return s.modify(func() error {
+		user := s.findByID(userID)
+		if user == nil {
+			return ErrUserNotFound
+		}
+		if !s.roleExists(role) {
+			return ErrRoleNotFound
+		}
+
+		roles := user.Roles[:0]
+		for _, existing := range user.Roles {
+			if existing != role {
+				roles = append(roles, existing)
+			}
+		}
+		user.Roles = roles
+		return nil
+	})
+}
+
+// GetUserRoles returns the roles of a user
+func (s *StaticProvider) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return append([]string{}, user.Roles...), nil
+}
+
+// HealthCheck always succeeds, as the provider has no external dependency
+func (s *StaticProvider) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// modify runs fn under the write lock and persists the store when it succeeds.
+// A failed write rolls back to the previous state.
+func (s *StaticProvider) modify(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.store.clone()
+	if err := fn(); err != nil {
+		s.store = snapshot
+		return err
+	}
+
+	if s.config.Persist && s.config.File != "" {
+		if err := writeStaticStore(s.config.File, s.store); err != nil {
+			s.store = snapshot
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findByID returns the user with the given ID; callers must hold the lock
+func (s *StaticProvider) findByID(userID string) *staticUser {
+	for _, user := range s.store.Users {
+		if user.ID == userID {
+			return user
+		}
+	}
+	return nil
+}
+
+// findByUsername returns the user with the given username, ignoring case;
+// callers must hold the lock
+func (s *StaticProvider) findByUsername(username string) *staticUser {
+	for _, user := range s.store.Users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+// roleExists reports whether the role is in the catalog; callers must hold the lock
+func (s *StaticProvider) roleExists(role string) bool {
+	for _, existing := range s.store.Roles {
+		if existing == role {
+			return true
+		}
+	}
+	return false
+}
+
+// subject builds the session subject for the user
+func (u *staticUser) subject() *sessionSubject {
+	return &sessionSubject{
+		ID:       u.ID,
+		Username: u.Username,
+		Email:    u.Email,
+		Roles:    append([]string{}, u.Roles...),
+	}
+}
+
+// clone returns a deep copy of the store
+func (s *staticStore) clone() *staticStore {
+	clone := &staticStore{
+		Roles: append([]string{}, s.Roles...),
+		Users: make([]*staticUser, 0, len(s.Users)),
+	}
+	for _, user := range s.Users {
+		copied := *user
+		copied.Roles = append([]string{}, user.Roles...)
+		clone.Users = append(clone.Users, &copied)
+	}
+	return clone
+}
+
+// validate checks IDs and usernames are unique and every user role is in the
+// catalog, adding roles that are only referenced by users
+func (s *staticStore) validate() error {
+	ids := make(map[string]bool)
+	usernames := make(map[string]bool)
+	roles := make(map[string]bool)
+	for _, role := range s.Roles {
+		roles[role] = true
+	}
+
+	for i, user := range s.Users {
+		if user.ID == "" || user.Username == "" {
+			return fmt.Errorf("user %d: id and username are required", i)
+		}
+		if ids[user.ID] {
+			return fmt.Errorf("user %d: duplicate id %q", i, user.ID)
+		}
+		if usernames[strings.ToLower(user.Username)] {
+			return fmt.Errorf("user %d: duplicate username %q", i, user.Username)
+		}
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return fmt.Errorf("user %d: password_hash is not a bcrypt hash", i)
+		}
+		ids[user.ID] = true
+		usernames[strings.ToLower(user.Username)] = true
+
+		for _, role := range user.Roles {
+			if !roles[role] {
+				roles[role] = true
+				s.Roles = append(s.Roles, role)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readStaticStore loads a users file, choosing JSON or YAML by extension
+func readStaticStore(path string) (*staticStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var store staticStore
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &store)
+	} else {
+		err = yaml.Unmarshal(data, &store)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse users file: %w", err)
+	}
+
+	return &store, nil
+}
+
+// writeStaticStore atomically replaces a users file with the store's content
+func writeStaticStore(path string, store *staticStore) error {
+	var (
+		data []byte
+		err  error
+	)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err = json.MarshalIndent(store, "", "  ")
+	} else {
+		data, err = yaml.Marshal(store)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode users file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+
+	return nil
+}
+
+// NewStaticProvider creates a new StaticProvider instance from the users file
+// and the users configured inline
+func NewStaticProvider(cfg config.StaticConfig) (IAMProvider, error) {
+	if cfg.Persist && cfg.File == "" {
+		return nil, errors.New("static provider persistence requires a users file")
+	}
+	if cfg.Persist && len(cfg.Users) > 0 {
+		return nil, errors.New("static provider persistence cannot be combined with inline users")
+	}
+
+	store := &staticStore{Roles: append([]string{}, cfg.Roles...)}
+	if cfg.File != "" {
+		loaded, err := readStaticStore(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		store.Roles = append(store.Roles, loaded.Roles...)
+		store.Users = loaded.Users
+	}
+
+	for _, user := range cfg.Users {
+		// Derive missing IDs from the username, so they survive restarts
+		id := user.ID
+		if id == "" {
+			id = uuid.NewSHA1(staticUserNamespace, []byte(strings.ToLower(user.Username))).String()
+		}
+		store.Users = append(store.Users, &staticUser{
+			ID:           id,
+			Username:     user.Username,
+			Email:        user.Email,
+			PasswordHash: user.PasswordHash,
+			Roles:        append([]string{}, user.Roles...),
+		})
+	}
+
+	if err := store.validate(); err != nil {
+		return nil, fmt.Errorf("invalid static users: %w", err)
+	}
+
+	sessions, err := newSessionIssuer(&cfg.Session, "iam-bridge/static")
+	if err != nil {
+		return nil, err
+	}
+
+	// The dummy hash is of a random password, so that no password matches it
+	dummyPassword := make([]byte, 32)
+	if _, err := rand.Read(dummyPassword); err != nil {
+		return nil, fmt.Errorf("failed to generate dummy password: %w", err)
+	}
+	dummyHash, err := bcrypt.GenerateFromPassword(dummyPassword, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash dummy password: %w", err)
+	}
+
+	return &StaticProvider{
+		config:    &cfg,
+		sessions:  sessions,
+		dummyHash: dummyHash,
+		store:     store,
+	}, nil
+}
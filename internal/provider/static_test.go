@@ -0,0 +1,78 @@
+package provider_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider/providertest"
+)
+
+func TestStaticProviderConformance(t *testing.T) {
+	providertest.Run(t, func(t *testing.T) *providertest.Fixture {
+		p, err := provider.NewStaticProvider(config.StaticConfig{
+			File: filepath.Join("..", "..", "config", "users.example.yaml"),
+			Session: config.SessionTokenConfig{
+				SigningKey: "providertest-signing-key-0123456789",
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create provider: %v", err)
+		}
+
+		return &providertest.Fixture{
+			Provider:      p,
+			UserID:        "00000000-0000-0000-0000-000000000002",
+			Username:      "alice",
+			Password:      "alice-password",
+			Role:          "users:admin",
+			OtherUsername: "admin",
+		}
+	})
+}
+
+func TestStaticProviderDerivesInlineUserIDs(t *testing.T) {
+	cfg := config.StaticConfig{
+		Roles: []string{"users:read"},
+		Users: []config.StaticUser{
+			// Hashes of "admin-password" and "alice-password"
+			{Username: "admin", PasswordHash: "$2a$10$NPicWg4if2/VqmVGolmpX.JLqZ837pGoM60tfqzEdnnDoh/Vrh3Kq"},
+			{Username: "alice", PasswordHash: "$2a$10$84VIfFoRSqNOqrBQdu9Mru61gMApzzbBwdlrJWscC/ftnFW0LTARG"},
+		},
+		Session: config.SessionTokenConfig{
+			SigningKey: "providertest-signing-key-0123456789",
+		},
+	}
+
+	// userID logs in to a new provider and returns the ID in the access token
+	userID := func(username, password string) string {
+		t.Helper()
+
+		p, err := provider.NewStaticProvider(cfg)
+		if err != nil {
+			t.Fatalf("failed to create provider: %v", err)
+		}
+		tokens, err := p.Login(context.Background(), username, password)
+		if err != nil {
+			t.Fatalf("Login returned unexpected error: %v", err)
+		}
+		info, err := p.ValidateToken(context.Background(), tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("ValidateToken returned unexpected error: %v", err)
+		}
+		return info.UserID
+	}
+
+	first := userID("alice", "alice-password")
+	if first == "" {
+		t.Fatal("inline user has no ID")
+	}
+	if again := userID("alice", "alice-password"); again != first {
+		t.Errorf("inline user ID changed from %q to %q across restarts", first, again)
+	}
+	if other := userID("admin", "admin-password"); other == first {
+		t.Errorf("inline users share the ID %q", first)
+	}
+}
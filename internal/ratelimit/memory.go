@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled are evicted
+const sweepInterval = time.Minute
+
+// bucket is the state of a single token bucket
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled completely
+	full time.Time
+}
+
+// MemoryStore implements Store with buckets kept in process memory.
+// Buckets that have refilled completely are no different from new ones, so
+// they are evicted to keep memory bounded by the clients seen recently.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token from the bucket stored under key
+func (m *MemoryStore) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	// Refill for the time since the last request
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	b.updated = now
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	b.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// Len returns the number of buckets held
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.buckets)
+}
+
+// Close implements Store. Memory stores hold no connections.
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// sweep evicts the buckets that have refilled completely
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// seconds converts a number of seconds into a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
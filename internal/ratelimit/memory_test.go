@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	store.lastSweep = clock.now
+	return store, clock
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	store, clock := newTestStore()
+	limit := Limit{Rate: 1, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, _ := store.Allow(ctx, "client", limit)
+		if !result.Allowed {
+			t.Fatalf("request %d was limited within the burst", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d left %d tokens, want %d", i+1, result.Remaining, 2-i)
+		}
+	}
+
+	result, _ := store.Allow(ctx, "client", limit)
+	if result.Allowed {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("RetryAfter is %v, want 1s", result.RetryAfter)
+	}
+	if result.Reset != 3*time.Second {
+		t.Errorf("Reset is %v, want 3s", result.Reset)
+	}
+
+	if other, _ := store.Allow(ctx, "other-client", limit); !other.Allowed {
+		t.Error("a different key shared the exhausted bucket")
+	}
+
+	clock.Advance(time.Second)
+	if result, _ := store.Allow(ctx, "client", limit); !result.Allowed {
+		t.Error("request was limited after a token was refilled")
+	}
+}
+
+func TestMemoryStoreEvictsRefilledBuckets(t *testing.T) {
+	store, clock := newTestStore()
+	ctx := context.Background()
+
+	_, _ = store.Allow(ctx, "fast", Limit{Rate: 10, Burst: 10})
+	_, _ = store.Allow(ctx, "slow", Limit{Rate: 0.001, Burst: 10})
+
+	clock.Advance(sweepInterval)
+	_, _ = store.Allow(ctx, "new", Limit{Rate: 10, Burst: 10})
+
+	if n := store.Len(); n != 2 {
+		t.Errorf("store holds %d buckets after a sweep, want the slow and the new one", n)
+	}
+}
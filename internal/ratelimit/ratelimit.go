@@ -0,0 +1,53 @@
+// Package ratelimit provides token bucket rate limiting, with buckets kept in
+// memory or shared between instances through Redis
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// ErrStoreUnavailable is returned when a store cannot be reached
+var ErrStoreUnavailable = errors.New("rate limit store unavailable")
+
+// Limit is a token bucket refilled at Rate tokens per second that holds at
+// most Burst tokens. Every request takes one token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of a request against a bucket
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit int
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long until the next token is available, when the
+	// request was not allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps token buckets and takes tokens from them atomically, so that
+// instances sharing a store share their limits. Buckets are created full on
+// first use.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	// Close releases the connections held by the store
+	Close() error
+}
+
+// NewStore creates the store described by cfg
+func NewStore(cfg config.RateLimitStoreConfig) Store {
+	if strings.EqualFold(cfg.Type, "redis") {
+		return NewRedisStore(cfg.Redis)
+	}
+	return NewMemoryStore()
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+const (
+	// defaultRedisTimeout bounds a call to Redis when no timeout is configured
+	defaultRedisTimeout = 200 * time.Millisecond
+
+	// defaultRedisKeyPrefix namespaces bucket keys when no prefix is configured
+	defaultRedisKeyPrefix = "iam-bridge:ratelimit:"
+)
+
+// gcraScript implements the token bucket as GCRA (the generic cell rate
+// algorithm), which only needs to store the theoretical arrival time (TAT) of
+// the next request. Time comes from the Redis server, so replicas with skewed
+// clocks agree, and keys expire once their bucket has refilled.
+//
+// KEYS[1] is the bucket key. ARGV[1] is the emission interval (the time to
+// refill one token) and ARGV[2] the burst. Times are in microseconds.
+// Returns {allowed, remaining, retry after, reset}.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1])) or now
+if tat < now then
+	tat = now
+end
+
+local next_tat = tat + interval
+local allow_at = next_tat - burst * interval
+if now < allow_at then
+	return {0, 0, allow_at - now, tat - now}
+end
+
+redis.call("SET", KEYS[1], next_tat, "PX", math.ceil((next_tat - now) / 1000))
+return {1, math.floor((now - allow_at) / interval), 0, next_tat - now}
+`)
+
+// RedisStore implements Store on Redis, or any server speaking its protocol,
+// so that bridge instances share their limits
+type RedisStore struct {
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedisStore creates a new RedisStore. Connections are made on first use.
+func NewRedisStore(cfg config.RedisConfig) *RedisStore {
+	options := &redis.Options{
+		Addr:     cfg.Address,
+		Username: cfg.Username,
+		Password: cfg.Password.Value(),
+		DB:       cfg.DB,
+	}
+	if cfg.TLS {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultRedisTimeout
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultRedisKeyPrefix
+	}
+
+	return &RedisStore{
+		client:  redis.NewClient(options),
+		prefix:  prefix,
+		timeout: timeout,
+	}
+}
+
+// Allow takes a token from the bucket stored under key
+func (r *RedisStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	interval := int64(math.Ceil(float64(time.Second/time.Microsecond) / limit.Rate))
+	values, err := gcraScript.Run(ctx, r.client, []string{r.prefix + key}, interval, limit.Burst).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrStoreUnavailable, err)
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("%w: unexpected script result %v", ErrStoreUnavailable, values)
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Burst,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		Reset:      time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
+
+// Close closes the connections to Redis
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// newTestRedisStore starts an embedded Redis-compatible server with a
+// manually advanced clock and returns a store connected to it
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	server.SetTime(time.Unix(1_700_000_000, 0))
+
+	store := NewRedisStore(config.RedisConfig{Address: server.Addr()})
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	return store, server
+}
+
+func TestRedisStoreTokenBucket(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	limit := Limit{Rate: 1, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Allow(ctx, "client", limit)
+		if err != nil {
+			t.Fatalf("Allow returned unexpected error: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d was limited within the burst", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d left %d tokens, want %d", i+1, result.Remaining, 2-i)
+		}
+	}
+
+	result, err := store.Allow(ctx, "client", limit)
+	if err != nil {
+		t.Fatalf("Allow returned unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("RetryAfter is %v, want 1s", result.RetryAfter)
+	}
+	if result.Reset != 3*time.Second {
+		t.Errorf("Reset is %v, want 3s", result.Reset)
+	}
+
+	server.SetTime(time.Unix(1_700_000_001, 0))
+	if result, _ := store.Allow(ctx, "client", limit); !result.Allowed {
+		t.Error("request was limited after a token was refilled")
+	}
+}
+
+func TestRedisStoreSharedBetweenInstances(t *testing.T) {
+	first, server := newTestRedisStore(t)
+	second := NewRedisStore(config.RedisConfig{Address: server.Addr()})
+	defer second.Close()
+
+	limit := Limit{Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	_, _ = first.Allow(ctx, "client", limit)
+	_, _ = second.Allow(ctx, "client", limit)
+
+	if result, _ := first.Allow(ctx, "client", limit); result.Allowed {
+		t.Error("instances sharing a store did not share the bucket")
+	}
+}
+
+func TestRedisStoreExpiresRefilledBuckets(t *testing.T) {
+	store, server := newTestRedisStore(t)
+
+	_, _ = store.Allow(context.Background(), "client", Limit{Rate: 1, Burst: 5})
+
+	server.FastForward(time.Second)
+	if n := len(server.Keys()); n != 0 {
+		t.Errorf("Redis holds %d keys once the bucket has refilled, want 0", n)
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	server.Close()
+
+	_, err := store.Allow(context.Background(), "client", Limit{Rate: 1, Burst: 1})
+	if !errors.Is(err, ErrStoreUnavailable) {
+		t.Errorf("Allow returned %v, want ErrStoreUnavailable", err)
+	}
+}
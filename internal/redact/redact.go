@@ -0,0 +1,230 @@
+// Package redact masks secrets and personal data in request and response
+// headers and bodies before they are logged
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+)
+
+// Mask replaces redacted values
+const Mask = "[REDACTED]"
+
+var (
+	// defaultFields are the JSON fields redacted when none are configured:
+	// credentials and tokens, and the personal data of users
+	defaultFields = []string{
+		"password", "client_secret", "secret", "token",
+		"access_token", "refresh_token", "id_token",
+		"email", "username", "preferred_username",
+		"name", "given_name", "family_name", "first_name", "last_name",
+	}
+
+	// defaultHeaders are the headers redacted when none are configured
+	defaultHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key",
+	}
+
+	// defaultPatterns are the patterns redacted when none are configured. The
+	// default matches JWTs.
+	defaultPatterns = []string{
+		`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+	}
+)
+
+// Redactor masks the configured fields, headers and patterns
+type Redactor struct {
+	// names are fields redacted at any depth
+	names map[string]bool
+	// paths are fields redacted at a path from the root
+	paths    [][]string
+	headers  map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// New creates a Redactor from cfg, falling back to the defaults for empty lists
+func New(cfg config.RedactConfig) (*Redactor, error) {
+	fields, headers, patterns := cfg.Fields, cfg.Headers, cfg.Patterns
+	if len(fields) == 0 {
+		fields = defaultFields
+	}
+	if len(headers) == 0 {
+		headers = defaultHeaders
+	}
+	if len(patterns) == 0 {
+		patterns = defaultPatterns
+	}
+
+	r := &Redactor{
+		names:   make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+	for _, field := range fields {
+		path := strings.Split(strings.ToLower(strings.TrimSpace(field)), ".")
+		if len(path) == 1 {
+			r.names[path[0]] = true
+			continue
+		}
+		r.paths = append(r.paths, path)
+	}
+	for _, header := range headers {
+		r.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// Headers returns the headers with the configured ones masked and the
+// patterns masked in the others. Multiple values are joined by commas.
+func (r *Redactor) Headers(header http.Header) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for name, values := range header {
+		if r.headers[http.CanonicalHeaderKey(name)] {
+			redacted[name] = Mask
+			continue
+		}
+		redacted[name] = r.String(strings.Join(values, ", "))
+	}
+	return redacted
+}
+
+// Body returns body with the configured fields and the patterns masked.
+// JSON and form bodies are redacted field by field, other bodies by pattern
+// only. ok is false when a JSON or form body cannot be parsed, as it cannot
+// then be redacted safely.
+func (r *Redactor) Body(contentType string, body []byte) (redacted string, ok bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return r.json(body)
+	case mediaType == "application/x-www-form-urlencoded":
+		return r.form(body)
+	default:
+		return r.String(string(body)), true
+	}
+}
+
+// String returns s with the patterns masked
+func (r *Redactor) String(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Mask)
+	}
+	return s
+}
+
+// json redacts a JSON body field by field
+func (r *Redactor) json(body []byte) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.value(value, nil)); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(out.String(), "\n"), true
+}
+
+// value redacts a decoded JSON value found at path. Array elements share the
+// path of their array.
+func (r *Redactor) value(value interface{}, path []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := append(path[:len(path):len(path)], strings.ToLower(key))
+			if r.field(childPath) {
+				v[key] = Mask
+				continue
+			}
+			v[key] = r.value(child, childPath)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.value(child, path)
+		}
+		return v
+	case string:
+		return r.String(v)
+	default:
+		return v
+	}
+}
+
+// field reports whether the field at path is redacted
+func (r *Redactor) field(path []string) bool {
+	if r.names[path[len(path)-1]] {
+		return true
+	}
+
+	for _, fieldPath := range r.paths {
+		if len(fieldPath) != len(path) {
+			continue
+		}
+		match := true
+		for i := range fieldPath {
+			if fieldPath[i] != "*" && fieldPath[i] != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// form redacts a URL-encoded form body field by field
+func (r *Redactor) form(body []byte) (string, bool) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", false
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out strings.Builder
+	for _, key := range keys {
+		redactField := r.field([]string{strings.ToLower(key)})
+		for _, value := range values[key] {
+			if out.Len() > 0 {
+				out.WriteByte('&')
+			}
+			out.WriteString(url.QueryEscape(key))
+			out.WriteByte('=')
+			if redactField {
+				out.WriteString(Mask)
+			} else {
+				out.WriteString(url.QueryEscape(r.String(value)))
+			}
+		}
+	}
+	return out.String(), true
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/middleware"
+	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/ratelimit"
+	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
+)
+
+const (
+	// reloadDebounce is how long a burst of config file events must settle
+	// before the configuration is reloaded
+	reloadDebounce = 500 * time.Millisecond
+
+	// reloadHealthCheckTimeout bounds the health check of a new provider
+	reloadHealthCheckTimeout = 10 * time.Second
+)
+
+// serverState holds the configuration and the middleware built from it that
+// are replaced as a whole on every reload
+type serverState struct {
+	config           *config.Config
+	cors             gin.HandlerFunc
+	preAuthRateLimit gin.HandlerFunc
+	rateLimit        gin.HandlerFunc
+	authorization    gin.HandlerFunc
+
+	// rateLimitStore holds the token buckets, or is nil when rate limiting is
+	// disabled
+	rateLimitStore ratelimit.Store
+}
+
+// newServerState builds the reloadable middleware for cfg. The rate limit
+// store of previous is taken over when its configuration is unchanged, so
+// buckets survive the reload.
+func (s *Server) newServerState(cfg *config.Config, previous *serverState) *serverState {
+	state := &serverState{
+		config:        cfg,
+		cors:          middleware.CORSMiddleware(&cfg.Security.CORS),
+		authorization: middleware.AuthorizationMiddleware(&cfg.Security.Authorization),
+		preAuthRateLimit: func(c *gin.Context) {
+			c.Next()
+		},
+		rateLimit: func(c *gin.Context) {
+			c.Next()
+		},
+	}
+
+	// Add rate limiting if enabled
+	rateLimit := &cfg.Security.RateLimit
+	if rateLimit.Enabled {
+		if previous != nil && previous.rateLimitStore != nil &&
+			reflect.DeepEqual(previous.config.Security.RateLimit.Store, rateLimit.Store) {
+			state.rateLimitStore = previous.rateLimitStore
+		} else {
+			state.rateLimitStore = ratelimit.NewStore(rateLimit.Store)
+		}
+		state.preAuthRateLimit = middleware.PreAuthRateLimitMiddleware(rateLimit, state.rateLimitStore)
+		state.rateLimit = middleware.RateLimitMiddleware(rateLimit, state.rateLimitStore)
+	}
+
+	return state
+}
+
+// close releases what the state holds that the next state did not take over.
+// Requests still running on the state fall back to the failure mode of the
+// rate limit store.
+func (state *serverState) close(next *serverState) error {
+	if state.rateLimitStore == nil || next != nil && next.rateLimitStore == state.rateLimitStore {
+		return nil
+	}
+	return state.rateLimitStore.Close()
+}
+
+// reloadable returns a middleware that runs the version of a middleware built
+// for the current configuration
+func (s *Server) reloadable(pick func(state *serverState) gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pick(s.state.Load())(c)
+	}
+}
+
+// Reload reads the configuration again and validates it and, when the iam
+// block changed, builds the IAM provider it describes and checks its health.
+// Only then are the provider and the CORS, rate limit, authorization and login
+// protection settings swapped in; requests in flight finish on the previous
+// ones. On any error the running configuration is kept.
+//
+// Settings read at startup, such as app.port, logging and tenancy, take
+// effect on the next restart.
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, err := config.LoadConfig(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	// Keep the running provider when its configuration is unchanged, so that
+	// the sessions it revoked and the keys it cached survive the reload
+	previous := s.state.Load()
+	if !reflect.DeepEqual(previous.config.IAM, cfg.IAM) {
+		if err := s.swapProvider(cfg); err != nil {
+			return err
+		}
+	}
+	s.loginTracker.Configure(cfg.Security.LoginProtection)
+
+	state := s.newServerState(cfg, previous)
+	s.state.Store(state)
+	if err := previous.close(state); err != nil {
+		s.logger.Error("Failed to close previous rate limit store", logger.Err(err))
+	}
+
+	return nil
+}
+
+// swapProvider builds the IAM provider described by cfg and, once it is
+// healthy, swaps it in
+func (s *Server) swapProvider(cfg *config.Config) error {
+	iamProvider, err := provider.NewIAMProvider(&cfg.IAM, s.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create IAM provider: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reloadHealthCheckTimeout)
+	defer cancel()
+
+	if err := iamProvider.HealthCheck(ctx); err != nil {
+		if closer, ok := iamProvider.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		return fmt.Errorf("new IAM provider is unhealthy: %w", err)
+	}
+
+	s.iamProvider.Swap(iamProvider)
+	return nil
+}
+
+// watchConfig reloads the configuration when a config file changes or the
+// process receives SIGHUP
+func (s *Server) watchConfig() {
+	if err := config.WatchConfig(s.config.WatchedFiles(), s.scheduleReload); err != nil {
+		s.logger.Warn("Failed to watch config file, reload with SIGHUP instead", logger.Err(err))
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			s.reload()
+		}
+	}()
+}
+
+// scheduleReload reloads once config file events have settled
+func (s *Server) scheduleReload() {
+	s.reloadTimerMu.Lock()
+	defer s.reloadTimerMu.Unlock()
+
+	if s.reloadTimer != nil {
+		s.reloadTimer.Stop()
+	}
+	s.reloadTimer = time.AfterFunc(reloadDebounce, s.reload)
+}
+
+// reload reloads the configuration and logs the outcome
+func (s *Server) reload() {
+	if err := s.Reload(); err != nil {
+		s.logger.Error("Configuration reload failed, keeping the running configuration", logger.Err(err))
+		return
+	}
+	s.logger.Info("Configuration reloaded")
+}
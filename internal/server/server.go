@@ -2,16 +2,22 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/zahidhasanpapon/iam-bridge/internal/config"
+	"github.com/zahidhasanpapon/iam-bridge/internal/lockout"
 	"github.com/zahidhasanpapon/iam-bridge/internal/middleware"
 	"github.com/zahidhasanpapon/iam-bridge/internal/provider"
+	"github.com/zahidhasanpapon/iam-bridge/internal/redact"
 	"github.com/zahidhasanpapon/iam-bridge/pkg/logger"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,26 +26,46 @@ import (
 
 // Server represents the HTTP server and its dependencies
 type Server struct {
+	// config is the configuration the server was started with. Settings that
+	// can be reloaded are read from state instead.
 	config      *config.Config
+	configPath  string
 	logger      logger.Logger
 	router      *gin.Engine
-	iamProvider provider.IAMProvider
+	iamProvider *provider.ReloadableProvider
 	httpServer  *http.Server
+
+	// loginTracker counts failed logins. It is reconfigured rather than
+	// replaced on reload, so lockouts survive it.
+	loginTracker *lockout.Tracker
+
+	state         atomic.Pointer[serverState]
+	reloadMu      sync.Mutex
+	reloadTimerMu sync.Mutex
+	reloadTimer   *time.Timer
 }
 
-// NewServer creates a new server instance
-func NewServer() (*Server, error) {
+// NewServer creates a new server instance with the configuration at
+// configPath, a config file or a directory holding config.yaml
+func NewServer(configPath string) (*Server, error) {
 	// Load configuration
-	cfg, err := config.LoadConfig("config")
+	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 
 	// Initialize logger
-	log, _ := logger.NewLogger(&cfg.Logging)
+	log, err := logger.NewLogger(&cfg.Logging)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logger: %w", err)
+	}
+	logger.SetDefault(log)
 
 	// Initialize IAM provider
-	iamProvider, err := provider.NewIAMProvider(&cfg.IAM, &log)
+	iamProvider, err := provider.NewIAMProvider(&cfg.IAM, log)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create IAM provider: %w", err)
 	}
@@ -49,42 +75,55 @@ func NewServer() (*Server, error) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Create router with default middleware
+	// Create router with default middleware. Forwarded client IPs are only
+	// trusted from the configured proxies, as the rate limiter and login
+	// protection count per client IP.
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.App.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("failed to set trusted proxies: %w", err)
+	}
 
 	// Create server instance
 	server := &Server{
-		config:      cfg,
-		logger:      log,
-		router:      router,
-		iamProvider: iamProvider,
+		config:       cfg,
+		configPath:   configPath,
+		logger:       log,
+		router:       router,
+		iamProvider:  provider.NewReloadableProvider(iamProvider),
+		loginTracker: lockout.NewTracker(cfg.Security.LoginProtection),
 	}
+	server.state.Store(server.newServerState(cfg, nil))
 
 	// Initialize server
-	server.setupMiddleware()
+	if err := server.setupMiddleware(); err != nil {
+		return nil, err
+	}
 	server.setupRoutes()
 
 	return server, nil
 }
 
 // setupMiddleware configures all middleware for the server
-func (s *Server) setupMiddleware() {
+func (s *Server) setupMiddleware() error {
+	redactor, err := redact.New(s.config.Logging.Capture.Redact)
+	if err != nil {
+		return fmt.Errorf("failed to create log redactor: %w", err)
+	}
+
 	// Swagger endpoint
 	s.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	
 	// Add basic middleware
 	s.router.Use(
 		middleware.RequestIDMiddleware(),
-		middleware.LoggerMiddleware(s.logger),
-		middleware.RecoveryMiddleware(s.logger),
-		middleware.CORSMiddleware(&s.config.Security.CORS),
+		middleware.LoggerMiddleware(s.logger, &s.config.Logging.Capture, redactor),
+		middleware.RecoveryMiddleware(),
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.cors }),
 		middleware.ErrorHandlerMiddleware(),
+		middleware.TenantMiddleware(&s.config.Tenancy),
 	)
 
-	// Add rate limiting if enabled
-	if s.config.Security.RateLimit.Enabled {
-		// TODO: Implement rate limiting middleware
-	}
+	return nil
 }
 
 // setupRoutes configures all routes for the server
@@ -100,105 +139,182 @@ func (s *Server) setupRoutes() {
 	s.router.GET("/health", s.handleHealthCheck)
 
 	// API routes
-	api := s.router.Group("/api/v1")
-	{
-		// Authentication routes
-		auth := api.Group("/auth")
-		{
-			// @Summary Login
-			// @Description Authenticates a user and provides a token
-			// @Tags Authentication
-			// @Accept json
-			// @Produce json
-			// @Param credentials body struct{Username string; Password string} true "Login credentials"
-			// @Success 200 {object} map[string]string
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/auth/login [post]
-			auth.POST("/login", s.handleLogin)
-
-			// @Summary Logout
-			// @Description Logs out a user by invalidating their token
-			// @Tags Authentication
-			// @Security BearerAuth
-			// @Success 204
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/auth/logout [post]
-			auth.POST("/logout", s.handleLogout)
-
-			// @Summary Refresh Token
-			// @Description Refreshes an access token using a refresh token
-			// @Tags Authentication
-			// @Accept json
-			// @Produce json
-			// @Param refreshToken body struct{RefreshToken string} true "Refresh token"
-			// @Success 200 {object} map[string]string
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/auth/refresh [post]
-			auth.POST("/refresh", s.handleRefreshToken)
-
-			// @Summary Validate Token
-			// @Description Validates the provided token
-			// @Tags Authentication
-			// @Security BearerAuth
-			// @Success 200 {object} map[string]interface{}
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/auth/validate [get]
-			auth.GET("/validate", s.handleValidateToken)
-		}
+	s.registerAPIRoutes(s.router.Group("/api/v1"))
 
-		// User management routes
-		users := api.Group("/users")
-		{
-			// @Summary Get User Info
-			// @Description Retrieves information about a specific user
-			// @Tags Users
-			// @Param id path string true "User ID"
-			// @Produce json
-			// @Success 200 {object} map[string]interface{}
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/users/{id} [get]
-			users.GET("/:id", s.handleGetUserInfo)
-
-			// @Summary Update User Info
-			// @Description Updates the information of a specific user
-			// @Tags Users
-			// @Param id path string true "User ID"
-			// @Param userInfo body struct{...} true "User information payload"
-			// @Success 204
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/users/{id} [put]
-			users.PUT("/:id", s.handleUpdateUserInfo)
-
-			// @Summary Assign Role
-			// @Description Assigns a role to a specific user
-			// @Tags Users
-			// @Param id path string true "User ID"
-			// @Param role body struct{Role string} true "Role payload"
-			// @Success 204
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/users/{id}/roles [post]
-			users.POST("/:id/roles", s.handleAssignRole)
-
-			// @Summary Remove Role
-			// @Description Removes a role from a specific user
-			// @Tags Users
-			// @Param id path string true "User ID"
-			// @Param role path string true "Role"
-			// @Success 204
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/users/{id}/roles/{role} [delete]
-			users.DELETE("/:id/roles/:role", s.handleRemoveRole)
-
-			// @Summary Get User Roles
-			// @Description Retrieves the roles of a specific user
-			// @Tags Users
-			// @Param id path string true "User ID"
-			// @Produce json
-			// @Success 200 {object} map[string]interface{}
-			// @Failure 400 {object} map[string]interface{}
-			// @Router /api/v1/users/{id}/roles [get]
-			users.GET("/:id/roles", s.handleGetUserRoles)
-		}
+	// Tenant-scoped API routes, e.g. /api/v1/t/acme/auth/login
+	if strings.EqualFold(s.config.Tenancy.Mode, "path") {
+		s.registerAPIRoutes(s.router.Group("/api/v1" + middleware.TenantPathPrefix))
+	}
+}
+
+// registerAPIRoutes registers the versioned API routes on the given group
+func (s *Server) registerAPIRoutes(api *gin.RouterGroup) {
+	// Authentication routes
+	auth := api.Group("/auth",
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.rateLimit }),
+	)
+	{
+		// @Summary Login
+		// @Description Authenticates a user and provides a token
+		// @Tags Authentication
+		// @Accept json
+		// @Produce json
+		// @Param credentials body struct{Username string; Password string} true "Login credentials"
+		// @Success 200 {object} tokenResponse
+		// @Failure 400 {object} map[string]interface{}
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 429 {object} middleware.APIError
+		// @Router /api/v1/auth/login [post]
+		auth.POST("/login", s.handleLogin)
+
+		// @Summary Logout
+		// @Description Logs out a user by invalidating their token
+		// @Tags Authentication
+		// @Security BearerAuth
+		// @Success 204
+		// @Failure 400 {object} map[string]interface{}
+		// @Router /api/v1/auth/logout [post]
+		auth.POST("/logout", s.handleLogout)
+
+		// @Summary Refresh Token
+		// @Description Refreshes an access token using a refresh token
+		// @Tags Authentication
+		// @Accept json
+		// @Produce json
+		// @Param refreshToken body struct{RefreshToken string} true "Refresh token"
+		// @Success 200 {object} tokenResponse
+		// @Failure 400 {object} map[string]interface{}
+		// @Router /api/v1/auth/refresh [post]
+		auth.POST("/refresh", s.handleRefreshToken)
+
+		// @Summary Validate Token
+		// @Description Validates the provided token
+		// @Tags Authentication
+		// @Security BearerAuth
+		// @Success 200 {object} map[string]interface{}
+		// @Failure 400 {object} map[string]interface{}
+		// @Router /api/v1/auth/validate [get]
+		auth.GET("/validate", s.handleValidateToken)
+	}
+
+	// User management routes
+	// Requests are limited per IP before authentication, so that invalid
+	// tokens are limited too, and by the configured key after it
+	users := api.Group("/users",
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.preAuthRateLimit }),
+		middleware.AuthMiddleware(s.iamProvider),
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.rateLimit }),
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.authorization }),
+	)
+	{
+		// @Summary Get User Info
+		// @Description Retrieves information about a specific user
+		// @Tags Users
+		// @Param id path string true "User ID"
+		// @Produce json
+		// @Success 200 {object} map[string]interface{}
+		// @Failure 400 {object} map[string]interface{}
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Router /api/v1/users/{id} [get]
+		users.GET("/:id", s.handleGetUserInfo)
+
+		// @Summary Update User Info
+		// @Description Updates the information of a specific user
+		// @Tags Users
+		// @Param id path string true "User ID"
+		// @Param userInfo body struct{...} true "User information payload"
+		// @Success 204
+		// @Failure 400 {object} map[string]interface{}
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Router /api/v1/users/{id} [put]
+		users.PUT("/:id", s.handleUpdateUserInfo)
+
+		// @Summary Assign Role
+		// @Description Assigns a role to a specific user
+		// @Tags Users
+		// @Param id path string true "User ID"
+		// @Param role body struct{Role string} true "Role payload"
+		// @Success 204
+		// @Failure 400 {object} map[string]interface{}
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Router /api/v1/users/{id}/roles [post]
+		users.POST("/:id/roles", s.handleAssignRole)
+
+		// @Summary Remove Role
+		// @Description Removes a role from a specific user
+		// @Tags Users
+		// @Param id path string true "User ID"
+		// @Param role path string true "Role"
+		// @Success 204
+		// @Failure 400 {object} map[string]interface{}
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Router /api/v1/users/{id}/roles/{role} [delete]
+		users.DELETE("/:id/roles/:role", s.handleRemoveRole)
+
+		// @Summary Get User Roles
+		// @Description Retrieves the roles of a specific user
+		// @Tags Users
+		// @Param id path string true "User ID"
+		// @Produce json
+		// @Success 200 {object} map[string]interface{}
+		// @Failure 400 {object} map[string]interface{}
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Router /api/v1/users/{id}/roles [get]
+		users.GET("/:id/roles", s.handleGetUserRoles)
+	}
+
+	// Administration routes
+	admin := api.Group("/admin",
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.preAuthRateLimit }),
+		middleware.AuthMiddleware(s.iamProvider),
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.rateLimit }),
+		s.reloadable(func(state *serverState) gin.HandlerFunc { return state.authorization }),
+	)
+	{
+		// @Summary List Lockouts
+		// @Description Lists the usernames and IPs locked after failed logins
+		// @Tags Admin
+		// @Produce json
+		// @Success 200 {object} map[string]interface{}
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Router /api/v1/admin/lockouts [get]
+		admin.GET("/lockouts", s.handleListLockouts)
+
+		// @Summary Clear Username Lockout
+		// @Description Clears the failed logins and lockout of a username in the request's tenant
+		// @Tags Admin
+		// @Param username path string true "Username"
+		// @Success 204
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Failure 404 {object} middleware.APIError
+		// @Router /api/v1/admin/lockouts/username/{username} [delete]
+		admin.DELETE("/lockouts/username/:username", s.handleClearUsernameLockout)
+
+		// @Summary Clear IP Lockout
+		// @Description Clears the failed logins and lockout of a client IP
+		// @Tags Admin
+		// @Param ip path string true "Client IP"
+		// @Success 204
+		// @Security BearerAuth
+		// @Failure 401 {object} middleware.APIError
+		// @Failure 403 {object} middleware.APIError
+		// @Failure 404 {object} middleware.APIError
+		// @Router /api/v1/admin/lockouts/ip/{ip} [delete]
+		admin.DELETE("/lockouts/ip/:ip", s.handleClearIPLockout)
 	}
 }
 
@@ -214,10 +330,13 @@ func (s *Server) Start() error {
 
 	// Start the server in a goroutine
 	go func() {
-		s.logger.Info("Starting server", "port", s.config.App.Port)
+		s.logger.Info("Starting server", logger.Int("port", s.config.App.Port))
 		serverErrors <- s.httpServer.ListenAndServe()
 	}()
 
+	// Reload the configuration when the file changes or on SIGHUP
+	s.watchConfig()
+
 	// Create a channel to listen for interrupt signals
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -240,6 +359,13 @@ func (s *Server) Start() error {
 			s.httpServer.Close()
 			return fmt.Errorf("could not stop server gracefully: %w", err)
 		}
+
+		if err := s.iamProvider.Close(); err != nil {
+			return fmt.Errorf("failed to close IAM provider: %w", err)
+		}
+		if err := s.state.Load().close(nil); err != nil {
+			return fmt.Errorf("failed to close rate limit store: %w", err)
+		}
 	}
 
 	return nil
@@ -253,6 +379,26 @@ func (s *Server) Stop(ctx context.Context) error {
 	return nil
 }
 
+// tokenResponseVersion identifies the shape of tokenResponse
+const tokenResponseVersion = "2"
+
+// tokenResponse is the response body of the login and refresh endpoints
+type tokenResponse struct {
+	Version string `json:"version"`
+	// Token mirrors AccessToken for clients of the original unversioned response
+	Token string `json:"token"`
+	provider.TokenSet
+}
+
+// newTokenResponse wraps a provider token set in the versioned response shape
+func newTokenResponse(tokens *provider.TokenSet) tokenResponse {
+	return tokenResponse{
+		Version:  tokenResponseVersion,
+		Token:    tokens.AccessToken,
+		TokenSet: *tokens,
+	}
+}
+
 // Handler functions
 func (s *Server) handleHealthCheck(c *gin.Context) {
 	// Check IAM provider health
@@ -281,19 +427,49 @@ func (s *Server) handleLogin(c *gin.Context) {
 		return
 	}
 
-	token, err := s.iamProvider.Login(c.Request.Context(), req.Username, req.Password)
+	attempt := lockout.Attempt{
+		Tenant:   middleware.GetTenant(c),
+		Username: req.Username,
+		IP:       c.ClientIP(),
+	}
+	decision, done := s.loginTracker.Begin(attempt)
+	if decision.Locked() {
+		middleware.SetRetryAfter(c, decision.RetryAfter)
+		c.Error(lockout.ErrLocked)
+		return
+	}
+	if decision.Busy {
+		c.Error(lockout.ErrBusy)
+		return
+	}
+	failed := false
+	defer func() { done(failed) }()
+
+	if decision.Delay > 0 {
+		timer := time.NewTimer(decision.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			c.Error(c.Request.Context().Err())
+			return
+		}
+	}
+
+	tokens, err := s.iamProvider.Login(c.Request.Context(), req.Username, req.Password)
 	if err != nil {
+		failed = errors.Is(err, provider.ErrInvalidCredentials)
 		c.Error(err)
 		return
 	}
+	s.loginTracker.Succeeded(attempt)
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-	})
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
 }
 
 func (s *Server) handleLogout(c *gin.Context) {
-	token := extractToken(c)
+	token := middleware.BearerToken(c)
 	if token == "" {
 		c.Error(provider.ErrTokenInvalid)
 		return
@@ -317,19 +493,17 @@ func (s *Server) handleRefreshToken(c *gin.Context) {
 		return
 	}
 
-	token, err := s.iamProvider.RefreshToken(c.Request.Context(), req.RefreshToken)
+	tokens, err := s.iamProvider.RefreshToken(c.Request.Context(), req.RefreshToken)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-	})
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
 }
 
 func (s *Server) handleValidateToken(c *gin.Context) {
-	token := extractToken(c)
+	token := middleware.BearerToken(c)
 	if token == "" {
 		c.Error(provider.ErrTokenInvalid)
 		return
@@ -439,17 +613,27 @@ func (s *Server) handleGetUserRoles(c *gin.Context) {
 	})
 }
 
-// Helper functions
-func extractToken(c *gin.Context) string {
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		return ""
-	}
+func (s *Server) handleListLockouts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": s.loginTracker.List(),
+	})
+}
+
+func (s *Server) handleClearUsernameLockout(c *gin.Context) {
+	s.clearLockout(c, lockout.KindUsername, c.Param("username"))
+}
 
-	// Remove "Bearer " prefix if present
-	if len(token) > 7 && token[:7] == "Bearer " {
-		return token[7:]
+func (s *Server) handleClearIPLockout(c *gin.Context) {
+	s.clearLockout(c, lockout.KindIP, c.Param("ip"))
+}
+
+// clearLockout clears the failures of a username in the request's tenant, or
+// of an IP
+func (s *Server) clearLockout(c *gin.Context, kind lockout.Kind, subject string) {
+	if !s.loginTracker.Clear(kind, middleware.GetTenant(c), subject) {
+		c.Error(lockout.ErrNotFound)
+		return
 	}
 
-	return token
+	c.Status(http.StatusNoContent)
 }
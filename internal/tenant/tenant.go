@@ -0,0 +1,18 @@
+// Package tenant carries the tenant a request is served for through its context
+package tenant
+
+import "context"
+
+// contextKey is the context key under which the tenant ID is stored
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the tenant ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID carried by ctx, or "" when there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
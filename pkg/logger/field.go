@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Field is a typed key/value pair of a log line
+type Field struct {
+	field zap.Field
+}
+
+// String creates a string field
+func String(key, value string) Field {
+	return Field{zap.String(key, value)}
+}
+
+// Int creates an integer field
+func Int(key string, value int) Field {
+	return Field{zap.Int(key, value)}
+}
+
+// Int64 creates a 64-bit integer field
+func Int64(key string, value int64) Field {
+	return Field{zap.Int64(key, value)}
+}
+
+// Float64 creates a floating point field
+func Float64(key string, value float64) Field {
+	return Field{zap.Float64(key, value)}
+}
+
+// Bool creates a boolean field
+func Bool(key string, value bool) Field {
+	return Field{zap.Bool(key, value)}
+}
+
+// Duration creates a field holding a duration
+func Duration(key string, value time.Duration) Field {
+	return Field{zap.Duration(key, value)}
+}
+
+// Time creates a field holding a point in time
+func Time(key string, value time.Time) Field {
+	return Field{zap.Time(key, value)}
+}
+
+// Err creates an "error" field holding the message of err
+func Err(err error) Field {
+	return Field{zap.Error(err)}
+}
+
+// Any creates a field of any type, encoded by reflection when it has no
+// better encoding, such as maps
+func Any(key string, value interface{}) Field {
+	return Field{zap.Any(key, value)}
+}
+
+// zapFields unwraps fields for zap
+func zapFields(fields []Field) []zap.Field {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	unwrapped := make([]zap.Field, len(fields))
+	for i, f := range fields {
+		unwrapped[i] = f.field
+	}
+	return unwrapped
+}
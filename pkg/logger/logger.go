@@ -1,29 +1,39 @@
 package logger
 
 import (
+	"context"
+	"strings"
+	"sync/atomic"
+
 	"github.com/zahidhasanpapon/iam-bridge/internal/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// Logger writes structured log lines. Every line has a message and typed
+// key/value fields, such as logger.String("user", id).
 type Logger interface {
-	Info(args ...interface{})
-	Infof(template string, args ...interface{})
-	Error(args ...interface{})
-	Errorf(template string, args ...interface{})
-	Fatal(args ...interface{})
-	Fatalf(template string, args ...interface{})
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	// Fatal logs and then exits the process
+	Fatal(msg string, fields ...Field)
+	// With returns a child logger that adds fields to every line it writes
+	With(fields ...Field) Logger
 }
 
 type zapLogger struct {
-	sugaredLogger *zap.SugaredLogger
+	logger *zap.Logger
 }
 
+// NewLogger creates a logger writing at the configured level, as JSON or, with
+// the console format, as human readable lines
 func NewLogger(cfg *config.LogConfig) (Logger, error) {
 	logConfig := zap.NewProductionConfig()
 
 	// Set log level based on logConfig
-	switch cfg.Level {
+	switch strings.ToLower(cfg.Level) {
 	case "debug":
 		logConfig.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
 	case "info":
@@ -36,39 +46,91 @@ func NewLogger(cfg *config.LogConfig) (Logger, error) {
 		logConfig.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	}
 
+	if strings.EqualFold(cfg.Format, "console") {
+		logConfig.Encoding = "console"
+		logConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+
 	logConfig.EncoderConfig.TimeKey = "timestamp"
 	logConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
-	logger, err := logConfig.Build()
+	logger, err := logConfig.Build(zap.AddCallerSkip(1))
 	if err != nil {
 		return nil, err
 	}
 
-	return &zapLogger{
-		sugaredLogger: logger.Sugar(),
-	}, nil
+	return &zapLogger{logger: logger}, nil
+}
+
+// nopLogger is the default logger until one is set
+var nopLogger = NewNop()
+
+// NewNop creates a logger that discards everything
+func NewNop() Logger {
+	return &zapLogger{logger: zap.NewNop()}
+}
+
+// FromZap wraps a zap logger, such as one recording lines in tests
+func FromZap(logger *zap.Logger) Logger {
+	return &zapLogger{logger: logger}
+}
+
+func (l *zapLogger) Debug(msg string, fields ...Field) {
+	l.logger.Debug(msg, zapFields(fields)...)
 }
 
-func (l *zapLogger) Info(args ...interface{}) {
-	l.sugaredLogger.Info(args...)
+func (l *zapLogger) Info(msg string, fields ...Field) {
+	l.logger.Info(msg, zapFields(fields)...)
 }
 
-func (l *zapLogger) Infof(template string, args ...interface{}) {
-	l.sugaredLogger.Infof(template, args...)
+func (l *zapLogger) Warn(msg string, fields ...Field) {
+	l.logger.Warn(msg, zapFields(fields)...)
 }
 
-func (l *zapLogger) Error(args ...interface{}) {
-	l.sugaredLogger.Error(args...)
+func (l *zapLogger) Error(msg string, fields ...Field) {
+	l.logger.Error(msg, zapFields(fields)...)
 }
 
-func (l *zapLogger) Errorf(template string, args ...interface{}) {
-	l.sugaredLogger.Errorf(template, args...)
+func (l *zapLogger) Fatal(msg string, fields ...Field) {
+	l.logger.Fatal(msg, zapFields(fields)...)
 }
 
-func (l *zapLogger) Fatal(args ...interface{}) {
-	l.sugaredLogger.Fatal(args...)
+func (l *zapLogger) With(fields ...Field) Logger {
+	return &zapLogger{logger: l.logger.With(zapFields(fields)...)}
 }
 
-func (l *zapLogger) Fatalf(template string, args ...interface{}) {
-	l.sugaredLogger.Fatalf(template, args...)
+// contextKey is the context key of the request logger
+type contextKey struct{}
+
+// defaultLogger holds the logger returned by FromContext for contexts without
+// a logger
+var defaultLogger atomic.Value
+
+// defaultHolder wraps the default logger, as atomic.Value requires every value
+// stored to have the same concrete type
+type defaultHolder struct {
+	log Logger
+}
+
+// SetDefault sets the logger returned by FromContext for contexts without a
+// logger, such as those of background work. It discards everything until set.
+func SetDefault(log Logger) {
+	defaultLogger.Store(defaultHolder{log})
+}
+
+// NewContext returns a copy of ctx carrying log
+func NewContext(ctx context.Context, log Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, log)
+}
+
+// FromContext returns the logger carried by ctx, which the middleware scopes
+// to the request ID, tenant and user of a request, or the default logger
+func FromContext(ctx context.Context) Logger {
+	if log, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return log
+	}
+	if holder, ok := defaultLogger.Load().(defaultHolder); ok {
+		return holder.log
+	}
+	return nopLogger
 }
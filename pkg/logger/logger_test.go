@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFromContextCarriesFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log := &zapLogger{logger: zap.New(core)}
+
+	ctx := NewContext(context.Background(), log.With(String("request_id", "req-1")))
+	ctx = NewContext(ctx, FromContext(ctx).With(String("tenant", "acme"), String("user", "alice")))
+
+	FromContext(ctx).Warn("Something happened", Int("status", 502), Err(errors.New("boom")))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Level != zapcore.WarnLevel || entry.Message != "Something happened" {
+		t.Errorf("logged %s %q, want a warning with the message", entry.Level, entry.Message)
+	}
+
+	want := map[string]interface{}{
+		"request_id": "req-1",
+		"tenant":     "acme",
+		"user":       "alice",
+		"status":     int64(502),
+		"error":      "boom",
+	}
+	fields := entry.ContextMap()
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("field %s is %v, want %v", key, fields[key], value)
+		}
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	// Contexts without a logger get the default, which discards until set
+	FromContext(context.Background()).Info("discarded")
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	SetDefault(&zapLogger{logger: zap.New(core)})
+	t.Cleanup(func() {
+		SetDefault(nopLogger)
+	})
+
+	FromContext(context.Background()).Info("kept")
+	if logs.Len() != 1 {
+		t.Errorf("default logger got %d entries, want 1", logs.Len())
+	}
+}